@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 
 	"github.com/mad-weaver/laminate/internal/sloghelper"
@@ -15,10 +16,11 @@ import (
 // NewApp creates a new CLI application instance
 func NewApp() *cli.App {
 	app := &cli.App{
-		Name:     "laminate",
-		Usage:    "A CLI tool for layering structured data over structured data",
+		Name:  "laminate",
+		Usage: "A CLI tool for layering structured data over structured data",
 		Commands: []*cli.Command{
-			// Add commands here
+			NewExplainCommand(),
+			NewMerge3Command(),
 		},
 		Flags: []cli.Flag{
 			&cli.StringFlag{
@@ -32,6 +34,21 @@ func NewApp() *cli.App {
 				Usage:   "Apply patch file over source -- can be specified multiple times, use '-' for stdin",
 				Value:   cli.NewStringSlice(),
 			},
+			&cli.GenericFlag{
+				Name:  "set",
+				Usage: "Set a value after all patches are applied, as path=value -- can be specified multiple times",
+				Value: &unsplitSlice{},
+			},
+			&cli.GenericFlag{
+				Name:  "unset",
+				Usage: "Delete a key after all patches and --set values are applied -- can be specified multiple times",
+				Value: &unsplitSlice{},
+			},
+			&cli.GenericFlag{
+				Name:  "var",
+				Usage: "Define a variable for patch conditions, as name=value -- can be specified multiple times",
+				Value: &unsplitSlice{},
+			},
 			&cli.BoolFlag{
 				Name:    "debug",
 				Usage:   "Enable debug logging",
@@ -63,7 +80,61 @@ func NewApp() *cli.App {
 			&cli.StringFlag{
 				Name:  "merge-strategy",
 				Value: "overwrite",
-				Usage: "Specify list merge strategy (preserve, overwrite)",
+				Usage: "Specify list merge strategy (preserve, overwrite, keyed, union, index, merge-patch)",
+			},
+			&cli.StringFlag{
+				Name:  "merge-key",
+				Value: "name",
+				Usage: "Specify the field used to match list items for the keyed merge strategy",
+			},
+			&cli.StringFlag{
+				Name:  "merge-rules",
+				Usage: "Specify a rules file mapping key paths to list merge strategies",
+			},
+			&cli.StringFlag{
+				Name:  "locked-keys",
+				Usage: "Specify a policy file listing key paths that patches may not change",
+			},
+			&cli.StringFlag{
+				Name:  "tombstone-marker",
+				Value: "__TOMBSTONE__",
+				Usage: "Specify the value that deletes a key when set in a patch",
+			},
+			&cli.StringFlag{
+				Name:  "key-match",
+				Value: "exact",
+				Usage: "Specify how patch keys match existing keys(exact, insensitive, normalized)",
+				Action: func(c *cli.Context, f string) error {
+					if f != "exact" && f != "insensitive" && f != "normalized" {
+						return fmt.Errorf("invalid key match mode: %s", f)
+					}
+					return nil
+				},
+			},
+			&cli.BoolFlag{
+				Name:  "empty-clears",
+				Usage: "Make an empty map or list in a patch clear the value it is merged into",
+			},
+			&cli.StringFlag{
+				Name:  "null-mode",
+				Usage: "Specify what a null value in a patch does(set, delete, ignore), defaults to delete with merge-patch and set otherwise",
+				Action: func(c *cli.Context, f string) error {
+					if f != "set" && f != "delete" && f != "ignore" {
+						return fmt.Errorf("invalid null mode: %s", f)
+					}
+					return nil
+				},
+			},
+			&cli.StringFlag{
+				Name:  "on-type-conflict",
+				Value: "replace",
+				Usage: "Specify what happens when a patch changes the type of a value(error, warn, replace)",
+				Action: func(c *cli.Context, f string) error {
+					if f != "error" && f != "warn" && f != "replace" {
+						return fmt.Errorf("invalid type conflict policy: %s", f)
+					}
+					return nil
+				},
 			},
 		},
 		Before: func(c *cli.Context) error {
@@ -102,3 +173,23 @@ func NewApp() *cli.App {
 	app.Action = DefaultApp
 	return app
 }
+
+// unsplitSlice is a flag value that collects every occurrence of a flag as given. Unlike cli.StringSlice it doesn't
+// split values on commas, which values such as --set 'tags=[a, b]' contain.
+type unsplitSlice []string
+
+// Set appends value to the slice.
+func (s *unsplitSlice) Set(value string) error {
+	*s = append(*s, value)
+	return nil
+}
+
+// String returns the values separated by commas.
+func (s *unsplitSlice) String() string {
+	return strings.Join(*s, ", ")
+}
+
+// Get returns the values as a []string, which is what koanf.Strings reads.
+func (s *unsplitSlice) Get() interface{} {
+	return []string(*s)
+}
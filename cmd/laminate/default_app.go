@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"strings"
 
 	"github.com/knadh/koanf/parsers/hcl"
 	"github.com/knadh/koanf/parsers/json"
@@ -37,30 +38,16 @@ func DefaultApp(c *cli.Context) error {
 }
 
 func Run(konfig *koanf.Koanf) error {
-	// Validate required source parameter
-	source := konfig.String("source")
-	if source == "" {
-		return fmt.Errorf("source parameter is required")
-	}
-
-	// Create base configuration from source
-	k, err := koanfuri.NewKoanfURI(source)
+	k, err := Laminate(konfig)
 	if err != nil {
-		return fmt.Errorf("failed to load source configuration: %w", err)
+		return err
 	}
 
-	// Apply patches in order
-	for _, patch := range konfig.Strings("patch") {
-		p, err := koanfuri.NewKoanfURI(patch)
-		if err != nil {
-			return fmt.Errorf("failed to load patch %q: %w", patch, err)
-		}
-
-		if err := k.Merge(p, konfig.String("merge-strategy")); err != nil {
-			return fmt.Errorf("failed to apply patch %q: %w", patch, err)
-		}
-	}
+	return Output(konfig, k)
+}
 
+// Output prints the configuration of k in the output format configured by konfig, or in the format k was loaded from.
+func Output(konfig *koanf.Koanf, k *koanfuri.KoanfURI) error {
 	// Determine output format, preferring explicitly specified format over source format
 	outputFormat := konfig.String("output-format")
 	if outputFormat == "" {
@@ -82,8 +69,12 @@ func Run(konfig *koanf.Koanf) error {
 		return fmt.Errorf("unsupported output format: %s", outputFormat)
 	}
 
-	// Marshal the configuration using the selected parser
-	data, err := k.GetKonfig().Marshal(parser)
+	// Marshal the configuration using the selected parser. TOML has no null, so null values are left out.
+	raw := k.GetKonfig().Raw()
+	if outputFormat == "toml" {
+		raw = dropNulls(raw).(map[string]interface{})
+	}
+	data, err := parser.Marshal(raw)
 	if err != nil {
 		return fmt.Errorf("failed to marshal configuration to %s: %w", outputFormat, err)
 	}
@@ -95,3 +86,126 @@ func Run(konfig *koanf.Koanf) error {
 	fmt.Println(string(data))
 	return nil
 }
+
+// Laminate loads the source configuration and applies every patch to it in order, as configured by konfig.
+func Laminate(konfig *koanf.Koanf) (*koanfuri.KoanfURI, error) {
+	// Validate required source parameter
+	source := konfig.String("source")
+	if source == "" {
+		return nil, fmt.Errorf("source parameter is required")
+	}
+
+	// Create base configuration from source
+	k, err := koanfuri.NewKoanfURI(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load source configuration: %w", err)
+	}
+	if k.IsJSONPatch() {
+		return nil, fmt.Errorf("source %q is a JSON Patch document, JSON Patch can only be used with --patch", source)
+	}
+	if directives := k.PatchDirectives(); len(directives) > 0 {
+		return nil, fmt.Errorf("%s cannot be used in source %q, only with --patch", strings.Join(directives, " and "), source)
+	}
+	if opts := k.Options(); opts.Strategy != "" || opts.MergeKey != "" {
+		return nil, fmt.Errorf("source %q: the strategy and key options only apply to patches", source)
+	}
+
+	mergeOpts := koanfuri.MergeOptions{
+		Strategy:        konfig.String("merge-strategy"),
+		MergeKey:        konfig.String("merge-key"),
+		TombstoneMarker: konfig.String("tombstone-marker"),
+		OnTypeConflict:  konfig.String("on-type-conflict"),
+		NullMode:        konfig.String("null-mode"),
+		EmptyClears:     konfig.Bool("empty-clears"),
+		KeyMatch:        konfig.String("key-match"),
+	}
+
+	// Collect variables for patch conditions
+	for _, v := range konfig.Strings("var") {
+		name, value, ok := strings.Cut(v, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid --var %q: expected name=value", v)
+		}
+		if mergeOpts.Vars == nil {
+			mergeOpts.Vars = make(map[string]string)
+		}
+		mergeOpts.Vars[name] = value
+	}
+
+	// Load per-path merge rules if provided
+	if rulesURI := konfig.String("merge-rules"); rulesURI != "" {
+		rules, err := koanfuri.LoadMergeRules(rulesURI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load merge rules %q: %w", rulesURI, err)
+		}
+		mergeOpts.Rules = rules
+	}
+
+	// Load locked keys if provided
+	if policyURI := konfig.String("locked-keys"); policyURI != "" {
+		locked, err := koanfuri.LoadLockedKeys(policyURI)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load locked keys %q: %w", policyURI, err)
+		}
+		mergeOpts.Locked = locked
+	}
+
+	// Apply patches in order
+	for _, patch := range konfig.Strings("patch") {
+		p, err := koanfuri.NewKoanfURI(patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load patch %q: %w", patch, err)
+		}
+
+		// Options given to the patch itself override the global list strategy
+		patchOpts := mergeOpts
+		if strategy := p.Options().Strategy; strategy != "" {
+			patchOpts.Strategy = strategy
+		}
+		if mergeKey := p.Options().MergeKey; mergeKey != "" {
+			patchOpts.MergeKey = mergeKey
+		}
+
+		if err := k.Merge(p, patchOpts); err != nil {
+			return nil, fmt.Errorf("failed to apply patch %q: %w", patch, err)
+		}
+	}
+
+	// Apply --set and --unset on top of every patch
+	set, unset := konfig.Strings("set"), konfig.Strings("unset")
+	if len(set) > 0 || len(unset) > 0 {
+		overrides, err := koanfuri.NewOverrides(set, unset)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.Merge(overrides, mergeOpts); err != nil {
+			return nil, fmt.Errorf("failed to apply --set and --unset: %w", err)
+		}
+	}
+
+	return k, nil
+}
+
+// dropNulls returns a copy of v without null map values and list items, at any depth.
+func dropNulls(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if item != nil {
+				out[k] = dropNulls(item)
+			}
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			if item != nil {
+				out = append(out, dropNulls(item))
+			}
+		}
+		return out
+	default:
+		return v
+	}
+}
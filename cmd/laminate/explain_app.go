@@ -0,0 +1,75 @@
+package laminate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// NewExplainCommand creates the explain subcommand, which shows which input set each value of the merged configuration
+func NewExplainCommand() *cli.Command {
+	return &cli.Command{
+		Name:      "explain",
+		Usage:     "Show which input last set each value of the merged configuration",
+		ArgsUsage: "[key.path ...]",
+		Action:    ExplainApp,
+	}
+}
+
+func ExplainApp(c *cli.Context) error {
+	// Get the context from metadata
+	ctx := c.App.Metadata["ctx"].(context.Context)
+
+	konfig, err := ParseCLI(c)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		slog.Debug("received cancellation signal")
+		return nil
+	default:
+	}
+
+	k, err := Laminate(konfig)
+	if err != nil {
+		return err
+	}
+
+	// Only explain the requested key paths and everything below them, or everything if none were given
+	keyPaths := c.Args().Slice()
+	found := make(map[string]bool)
+	for _, explanation := range k.Explain() {
+		if len(keyPaths) > 0 {
+			matched := false
+			for _, keyPath := range keyPaths {
+				if explanation.Path == keyPath || strings.HasPrefix(explanation.Path, keyPath+".") {
+					found[keyPath] = true
+					matched = true
+				}
+			}
+			if !matched {
+				continue
+			}
+		}
+
+		value, err := json.Marshal(explanation.Value)
+		if err != nil {
+			return fmt.Errorf("failed to format value of %s: %w", explanation.Path, err)
+		}
+		fmt.Printf("%s = %s  # %s\n", explanation.Path, value, explanation.Origin)
+	}
+
+	for _, keyPath := range keyPaths {
+		if !found[keyPath] {
+			return fmt.Errorf("key %q not found in merged configuration", keyPath)
+		}
+	}
+
+	return nil
+}
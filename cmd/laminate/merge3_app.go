@@ -0,0 +1,96 @@
+package laminate
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/mad-weaver/laminate/internal/koanfuri"
+	"github.com/urfave/cli/v2"
+)
+
+// NewMerge3Command creates the merge3 subcommand, which merges two edits of a configuration against their common ancestor
+func NewMerge3Command() *cli.Command {
+	return &cli.Command{
+		Name:  "merge3",
+		Usage: "Merge two edits of a configuration against their common ancestor, reporting conflicting keys",
+		Flags: []cli.Flag{
+			&cli.StringFlag{
+				Name:     "base",
+				Usage:    "Specify the common ancestor of both edits",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "ours",
+				Usage:    "Specify our edit, which wins conflicts",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:     "theirs",
+				Usage:    "Specify their edit",
+				Required: true,
+			},
+			&cli.StringFlag{
+				Name:  "conflicts",
+				Usage: "Write the conflict list as JSON to this file instead of stderr",
+			},
+		},
+		Action: Merge3App,
+	}
+}
+
+func Merge3App(c *cli.Context) error {
+	// Get the context from metadata
+	ctx := c.App.Metadata["ctx"].(context.Context)
+
+	konfig, err := ParseCLI(c)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case <-ctx.Done():
+		slog.Debug("received cancellation signal")
+		return nil
+	default:
+	}
+
+	inputs := make(map[string]*koanfuri.KoanfURI)
+	for _, name := range []string{"base", "ours", "theirs"} {
+		k, err := koanfuri.NewKoanfURI(konfig.String(name))
+		if err != nil {
+			return fmt.Errorf("failed to load %s configuration: %w", name, err)
+		}
+		inputs[name] = k
+	}
+
+	k := inputs["ours"]
+	conflicts, err := k.Merge3(inputs["base"], inputs["theirs"])
+	if err != nil {
+		return err
+	}
+
+	// The merged result is printed even with conflicts, holding our side of each of them
+	if err := Output(konfig, k); err != nil {
+		return err
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(conflicts, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal conflicts: %w", err)
+	}
+	if path := konfig.String("conflicts"); path != "" {
+		if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+			return fmt.Errorf("failed to write conflicts: %w", err)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, string(data))
+	}
+
+	return fmt.Errorf("%d conflicting keys between %s and %s", len(conflicts), konfig.String("ours"), konfig.String("theirs"))
+}
@@ -35,7 +35,7 @@ func ParseCLI(ctx *cli.Context) (*koanf.Koanf, error) {
 	}
 
 	// Push CLI args into koanf object
-	forcedInclude := []string{"loglevel", "logformat", "merge-strategy"}
+	forcedInclude := []string{"loglevel", "logformat", "merge-strategy", "merge-key", "tombstone-marker", "on-type-conflict", "key-match"}
 	if err := konfig.Load(urfave.NewUrfaveCliProvider(ctx, konfig, ".", false, forcedInclude), nil); err != nil {
 		return nil, err
 	}
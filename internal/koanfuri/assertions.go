@@ -0,0 +1,158 @@
+package koanfuri
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// directiveAssert is a top level key holding preconditions that the configuration merged so far must meet before the
+// document is merged on top of it, e.g.
+//
+//	__ASSERT__:
+//	  - path: environment
+//	    equals: production
+//	  - path: database.host
+//	    matches: '\.prod\.internal$'
+//	  - path: server.plugins
+//	    type: list
+//	  - path: legacy
+//	    exists: false
+//
+// Every assertion names a key path and any of: exists (whether the key must be present), equals (a value the key must
+// equal), matches (a regular expression the key's scalar value must match) and type (map, list, string, number, bool
+// or null). The key is removed when the document is loaded.
+const directiveAssert = "__ASSERT__"
+
+// assertion is a single precondition of a document.
+type assertion struct {
+	path      []string
+	exists    *bool
+	equals    interface{}
+	hasEquals bool
+	matches   *regexp.Regexp
+	typ       string
+}
+
+// extractAssertions removes the assertions from the document and keeps them on the KoanfURI.
+func (k *KoanfURI) extractAssertions() error {
+	if !k.konfig.Exists(directiveAssert) {
+		return nil
+	}
+	items, ok := k.konfig.Get(directiveAssert).([]interface{})
+	if !ok {
+		return fmt.Errorf("invalid %s in %s: assertions must be a list", directiveAssert, k)
+	}
+
+	assertions := make([]assertion, 0, len(items))
+	for i, item := range items {
+		a, err := parseAssertion(item)
+		if err != nil {
+			return fmt.Errorf("invalid %s in %s: assertion %d: %w", directiveAssert, k, i, err)
+		}
+		assertions = append(assertions, a)
+	}
+	k.konfig.Delete(directiveAssert)
+	k.assertions = assertions
+	return nil
+}
+
+// parseAssertion converts an item of the assertion list into an assertion.
+func parseAssertion(item interface{}) (assertion, error) {
+	fields, ok := item.(map[string]interface{})
+	if !ok {
+		return assertion{}, fmt.Errorf("must be a map")
+	}
+
+	var a assertion
+	for key, value := range fields {
+		switch key {
+		case "path":
+			keyPath, ok := value.(string)
+			if !ok || keyPath == "" {
+				return assertion{}, fmt.Errorf("path must be a non-empty key path")
+			}
+			a.path = splitPath(keyPath)
+		case "exists":
+			exists, ok := value.(bool)
+			if !ok {
+				return assertion{}, fmt.Errorf("exists must be true or false")
+			}
+			a.exists = &exists
+		case "equals":
+			a.equals, a.hasEquals = value, true
+		case "matches":
+			pattern, ok := value.(string)
+			if !ok {
+				return assertion{}, fmt.Errorf("matches must be a regular expression")
+			}
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return assertion{}, fmt.Errorf("invalid regular expression %q: %w", pattern, err)
+			}
+			a.matches = re
+		case "type":
+			typ, _ := value.(string)
+			switch typ {
+			case "map", "list", "string", "number", "bool", "null":
+			default:
+				return assertion{}, fmt.Errorf("type must be one of map, list, string, number, bool or null")
+			}
+			a.typ = typ
+		default:
+			return assertion{}, fmt.Errorf("unknown field %q", key)
+		}
+	}
+
+	if a.path == nil {
+		return assertion{}, fmt.Errorf("path is required")
+	}
+	if a.exists != nil && !*a.exists && (a.hasEquals || a.matches != nil || a.typ != "") {
+		return assertion{}, fmt.Errorf("exists: false cannot be combined with other checks")
+	}
+	return a, nil
+}
+
+// check returns an error describing why the assertion doesn't hold for the configuration root, or nil if it does.
+func (a assertion) check(root map[string]interface{}) error {
+	value, exists := lookupPath(root, a.path)
+	if a.exists != nil && !*a.exists {
+		if exists {
+			return fmt.Errorf("key %q exists", joinPath(a.path))
+		}
+		return nil
+	}
+	if !exists {
+		return fmt.Errorf("key %q does not exist", joinPath(a.path))
+	}
+
+	if a.hasEquals && !valuesEqual(value, a.equals) {
+		return fmt.Errorf("key %q is %v, expected %v", joinPath(a.path), value, a.equals)
+	}
+	if a.matches != nil {
+		switch value.(type) {
+		case map[string]interface{}, []interface{}, nil:
+			return fmt.Errorf("key %q is a %s, expected a value matching %q", joinPath(a.path), typeName(value), a.matches)
+		}
+		if !a.matches.MatchString(fmt.Sprint(value)) {
+			return fmt.Errorf("key %q is %v, expected a value matching %q", joinPath(a.path), value, a.matches)
+		}
+	}
+	if a.typ != "" && typeName(value) != a.typ {
+		return fmt.Errorf("key %q is a %s, expected a %s", joinPath(a.path), typeName(value), a.typ)
+	}
+	return nil
+}
+
+// checkAssertions checks the assertions of other against the configuration.
+func (k *KoanfURI) checkAssertions(other *KoanfURI) error {
+	if len(other.assertions) == 0 {
+		return nil
+	}
+	root := k.konfig.Raw()
+	for _, a := range other.assertions {
+		if err := a.check(root); err != nil {
+			return fmt.Errorf("assertion of %s failed: %w", other, err)
+		}
+	}
+	return nil
+}
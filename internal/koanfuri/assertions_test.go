@@ -0,0 +1,122 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeAssertions(t *testing.T) {
+	const base = `
+environment: production
+database:
+  host: db.prod.internal
+  port: 5432
+server:
+  plugins: [auth]
+`
+	tests := []struct {
+		name       string
+		assertions string
+		err        string
+	}{
+		{
+			name: "all assertions hold",
+			assertions: `
+  - path: environment
+    equals: production
+  - path: database.port
+    equals: 5432
+    type: number
+  - path: database.host
+    matches: '\.prod\.internal$'
+  - path: server.plugins
+    exists: true
+    type: list
+  - path: legacy
+    exists: false
+`,
+		},
+		{
+			name:       "equals",
+			assertions: "\n  - path: environment\n    equals: staging\n",
+			err:        `assertion of file:///patch.yaml failed: key "environment" is production, expected staging`,
+		},
+		{
+			name:       "matches",
+			assertions: "\n  - path: database.host\n    matches: '^localhost$'\n",
+			err:        `key "database.host" is db.prod.internal, expected a value matching "^localhost$"`,
+		},
+		{
+			name:       "matches needs a scalar",
+			assertions: "\n  - path: database\n    matches: prod\n",
+			err:        `key "database" is a map, expected a value matching "prod"`,
+		},
+		{
+			name:       "type",
+			assertions: "\n  - path: server.plugins\n    type: map\n",
+			err:        `key "server.plugins" is a list, expected a map`,
+		},
+		{
+			name:       "missing key",
+			assertions: "\n  - path: database.user\n",
+			err:        `key "database.user" does not exist`,
+		},
+		{
+			name:       "key that must not exist",
+			assertions: "\n  - path: database\n    exists: false\n",
+			err:        `key "database" exists`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			patch := newTestKoanfURI(t, "patch.yaml", "__ASSERT__:"+tc.assertions+"server:\n  port: 443\n")
+			require.False(t, patch.konfig.Exists(directiveAssert))
+
+			err := k.Merge(patch, MergeOptions{Strategy: "overwrite"})
+			if tc.err == "" {
+				require.NoError(t, err)
+				require.Equal(t, 443, k.konfig.Get("server.port"))
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+			require.False(t, k.konfig.Exists("server.port"))
+		})
+	}
+}
+
+func TestParseAssertions(t *testing.T) {
+	tests := []struct {
+		name       string
+		assertions string
+		err        string
+	}{
+		{name: "not a list", assertions: "environment", err: "assertions must be a list"},
+		{name: "missing path", assertions: "[{equals: 1}]", err: "path is required"},
+		{name: "unknown field", assertions: "[{path: a, equal: 1}]", err: `unknown field "equal"`},
+		{name: "invalid regexp", assertions: "[{path: a, matches: '('}]", err: "invalid regular expression"},
+		{name: "invalid type", assertions: "[{path: a, type: object}]", err: "type must be one of"},
+		{name: "contradiction", assertions: "[{path: a, exists: false, equals: 1}]", err: "cannot be combined"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "patch.yaml", "a: 1\n")
+			require.NoError(t, k.konfig.Set(directiveAssert, mustParseYAML(t, tc.assertions)))
+			require.ErrorContains(t, k.extractAssertions(), tc.err)
+		})
+	}
+}
+
+func TestPatchDirectivesAssertions(t *testing.T) {
+	require.Empty(t, newTestKoanfURI(t, "plain.yaml", "a: 1\n").PatchDirectives())
+	require.Equal(t, []string{directiveAssert}, newTestKoanfURI(t, "patch.yaml", "__ASSERT__:\n  - path: a\nb: 1\n").PatchDirectives())
+}
+
+// mustParseYAML parses a YAML value.
+func mustParseYAML(t *testing.T, data string) interface{} {
+	t.Helper()
+	return newTestKoanfURI(t, "value.yaml", "value: "+data+"\n").konfig.Get("value")
+}
@@ -0,0 +1,138 @@
+package koanfuri
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+
+	"github.com/google/cel-go/cel"
+	celast "github.com/google/cel-go/common/ast"
+)
+
+// directiveWhen is a top level key holding a CEL expression (https://cel.dev) that decides whether the document is
+// merged at all, e.g.
+//
+//	__WHEN__: 'env == "prod" && region.startsWith("eu")'
+//
+// The expression is evaluated against the configuration merged so far and must return a bool. Top level keys whose
+// names are CEL identifiers, other than CEL type names such as type or map, can be used directly, doc holds the whole
+// configuration (use has(doc.env) to test for a key that may be missing) and vars holds the variables passed in
+// MergeOptions.Vars. A missing top level key is only an error when the result depends on it. The document is skipped
+// when the expression is false. The key is removed when the document is loaded.
+const directiveWhen = "__WHEN__"
+
+// celIdentifier matches the names that can be declared as CEL variables.
+var celIdentifier = regexp.MustCompile(`^[_a-zA-Z][_a-zA-Z0-9]*$`)
+
+// celReserved lists the words CEL doesn't allow as identifiers.
+var celReserved = []string{
+	"true", "false", "null", "in", "as", "break", "const", "continue", "else", "for", "function", "if", "import",
+	"let", "loop", "package", "namespace", "return", "var", "void", "while",
+}
+
+// extractCondition removes the condition from the document and keeps it on the KoanfURI. Only the syntax is checked
+// here, the identifiers are known once the configuration the document is merged into is.
+func (k *KoanfURI) extractCondition() error {
+	if !k.konfig.Exists(directiveWhen) {
+		return nil
+	}
+	expr, ok := k.konfig.Get(directiveWhen).(string)
+	if !ok || expr == "" {
+		return fmt.Errorf("invalid %s in %s: condition must be a CEL expression", directiveWhen, k)
+	}
+
+	env, err := cel.NewEnv()
+	if err != nil {
+		return fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+	if _, issues := env.Parse(expr); issues != nil && issues.Err() != nil {
+		return fmt.Errorf("invalid %s in %s: %w", directiveWhen, k, issues.Err())
+	}
+	k.konfig.Delete(directiveWhen)
+	k.when = expr
+	return nil
+}
+
+// applies reports whether the condition of other holds for the configuration, true when other has no condition.
+func (k *KoanfURI) applies(other *KoanfURI, vars map[string]string) (bool, error) {
+	if other.when == "" {
+		return true, nil
+	}
+	root := k.konfig.Raw()
+	if vars == nil {
+		vars = map[string]string{}
+	}
+
+	env, err := cel.NewEnv(
+		cel.Variable("doc", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("vars", cel.MapType(cel.StringType, cel.StringType)),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+
+	// Keys named like a CEL type, such as type or map, stay reachable through doc only
+	declared := make(map[string]bool)
+	for _, variable := range env.Variables() {
+		declared[variable.Name()] = true
+	}
+	activation := map[string]interface{}{"doc": root, "vars": vars}
+	var opts []cel.EnvOption
+	for key, value := range root {
+		if declared[key] || !celIdentifier.MatchString(key) || slices.Contains(celReserved, key) {
+			continue
+		}
+		opts = append(opts, cel.Variable(key, cel.DynType))
+		activation[key] = value
+	}
+
+	// Identifiers that aren't keys of the configuration are declared without a value, so a condition on a missing key
+	// fails only when it is evaluated, and && and || can still decide without it
+	parsed, issues := env.Parse(other.when)
+	if issues != nil && issues.Err() != nil {
+		return false, fmt.Errorf("invalid %s in %s: %w", directiveWhen, other, issues.Err())
+	}
+	for _, name := range conditionIdents(parsed) {
+		if _, bound := activation[name]; bound || declared[name] || !celIdentifier.MatchString(name) || slices.Contains(celReserved, name) {
+			continue
+		}
+		declared[name] = true
+		opts = append(opts, cel.Variable(name, cel.DynType))
+	}
+
+	if env, err = env.Extend(opts...); err != nil {
+		return false, fmt.Errorf("failed to create CEL environment: %w", err)
+	}
+	ast, issues := env.Check(parsed)
+	if issues != nil && issues.Err() != nil {
+		return false, fmt.Errorf("invalid %s in %s: %w", directiveWhen, other, issues.Err())
+	}
+	if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+		return false, fmt.Errorf("invalid %s in %s: condition returns %s, expected bool", directiveWhen, other, ast.OutputType())
+	}
+	program, err := env.Program(ast)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s in %s: %w", directiveWhen, other, err)
+	}
+
+	out, _, err := program.Eval(activation)
+	if err != nil {
+		return false, fmt.Errorf("failed to evaluate %s of %s: %w", directiveWhen, other, err)
+	}
+	result, ok := out.Value().(bool)
+	if !ok {
+		return false, fmt.Errorf("%s of %s returned %v, expected true or false", directiveWhen, other, out.Value())
+	}
+	return result, nil
+}
+
+// conditionIdents returns the identifiers a parsed condition refers to.
+func conditionIdents(parsed *cel.Ast) []string {
+	var names []string
+	celast.PreOrderVisit(parsed.NativeRep().Expr(), celast.NewExprVisitor(func(expr celast.Expr) {
+		if expr.Kind() == celast.IdentKind {
+			names = append(names, expr.AsIdent())
+		}
+	}))
+	return names
+}
@@ -0,0 +1,102 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeConditions(t *testing.T) {
+	const base = `
+env: prod
+region: eu-west-1
+server:
+  port: 8080
+replicas: 1
+type: service
+map: {a: 1}
+`
+
+	tests := []struct {
+		name     string
+		when     string
+		vars     map[string]string
+		applies  bool
+		expected string
+	}{
+		{name: "top level keys", when: `env == "prod" && region.startsWith("eu")`, applies: true},
+		{name: "false condition", when: `env == "dev"`, applies: false},
+		{name: "nested keys", when: `server.port == 8080`, applies: true},
+		{name: "keys named like CEL types", when: `doc.type == "service" && doc.map.a == 1 && type(env) == string`, applies: true},
+		{name: "doc", when: `has(doc.missing) || doc.replicas < 2`, applies: true},
+		{name: "vars", when: `vars.stage == "ci"`, vars: map[string]string{"stage": "ci"}, applies: true},
+		{name: "missing var", when: `"stage" in vars && vars.stage == "ci"`, applies: false},
+		{name: "missing key decided by the other operand", when: `env == "dev" && missing.startsWith("eu")`, applies: false},
+		{name: "missing key with or", when: `missing == 1 || env == "prod"`, applies: true},
+		{name: "missing key", when: `missing == 1`, expected: "failed to evaluate __WHEN__"},
+		{name: "comprehension", when: `server.all(k, k == "port")`, applies: true},
+		{name: "not a bool", when: `replicas + 1`, expected: "expected bool"},
+		{name: "evaluation error", when: `vars.stage == "ci"`, expected: "failed to evaluate __WHEN__"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			patch := newTestKoanfURI(t, "patch.json", `{"replicas": 3}`)
+			require.NoError(t, patch.konfig.Set(directiveWhen, tt.when))
+			require.NoError(t, patch.extractCondition())
+
+			err := k.Merge(patch, MergeOptions{Strategy: "overwrite", Vars: tt.vars})
+			if tt.expected != "" {
+				require.ErrorContains(t, err, tt.expected)
+				return
+			}
+			require.NoError(t, err)
+			require.False(t, k.konfig.Exists(directiveWhen))
+			if tt.applies {
+				require.Equal(t, float64(3), k.konfig.Get("replicas"))
+			} else {
+				require.Equal(t, 1, k.konfig.Get("replicas"))
+			}
+		})
+	}
+}
+
+func TestConditionWithoutKey(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "env: dev\nreplicas: 1\n")
+	patch := newTestKoanfURI(t, "patch.yaml", "__WHEN__: 'env == \"prod\" && region.startsWith(\"eu\")'\nreplicas: 3\n")
+
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, 1, k.konfig.Get("replicas"))
+}
+
+func TestExtractConditionErrors(t *testing.T) {
+	for _, when := range []interface{}{1, "", "env =="} {
+		k := newTestKoanfURI(t, "patch.yaml", "a: 1\n")
+		require.NoError(t, k.konfig.Set(directiveWhen, when))
+		require.ErrorContains(t, k.extractCondition(), "invalid __WHEN__")
+	}
+}
+
+func TestSkippedPatchKeepsDirectives(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "env: dev\n")
+	patch := newTestKoanfURI(t, "patch.yaml", `
+__WHEN__: env == "prod"
+__LOCKED__: [env]
+__ASSERT__:
+  - path: missing
+env: prod
+`)
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, "dev", k.konfig.Get("env"))
+	require.Empty(t, k.locked)
+}
+
+func TestPatchDirectivesConditions(t *testing.T) {
+	k := newTestKoanfURI(t, "patch.yaml", "__WHEN__: env == \"prod\"\n__ASSERT__:\n  - path: env\nreplicas: 3\n")
+	require.Equal(t, []string{directiveAssert, directiveWhen}, k.PatchDirectives())
+
+	base := newTestKoanfURI(t, "base.yaml", "env: prod\n")
+	_, err := k.Merge3(base, base)
+	require.ErrorContains(t, err, "__ASSERT__ and __WHEN__ cannot be used in file:///patch.yaml, only in patches")
+}
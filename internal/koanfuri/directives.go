@@ -0,0 +1,186 @@
+package koanfuri
+
+import "fmt"
+
+// Directive keys that patch authors can place inside a patch to control how it is merged. They are interpreted by the merger
+// and never appear in the merged output.
+//
+// "__MERGE__" on a map selects "merge" (the default, deep merge) or "replace" (replace the destination map wholesale).
+// A map holding a "__VALUE__" key is a wrapper: "__MERGE__" then applies to the wrapped value, which lets a patch pick a list
+// strategy for a single list, e.g.
+//
+//	plugins:
+//	  __MERGE__: append
+//	  __VALUE__:
+//	    - name: cache
+//
+// List strategies accept every --merge-strategy value plus "append" (preserve) and "replace" (overwrite). "__MERGE_KEY__"
+// sets the merge key used by the keyed strategy and to find items for positional operations.
+//
+// Positional operations place the wrapped items at a specific position of the destination list instead:
+//
+//	"__MERGE__: prepend"                       puts the items in front of the list
+//	"__MERGE__: insert" with "__BEFORE__: x"   inserts the items before the item matching x
+//	"__MERGE__: insert" with "__AFTER__: x"    inserts the items after the item matching x
+//	"__MERGE__: insert" with "__INDEX__: n"    inserts the items at index n
+//	"__MERGE__: replace" with "__INDEX__: n"   replaces the item at index n with the wrapped value
+//
+// Items match x when they are maps whose merge key field equals x, or scalars equal to x.
+//
+// "__MOVE_FROM__" and "__COPY_FROM__" on a map take the value found at another dot separated key path of the destination
+// and place it at the map's own path, removing it from the old path when moving. Other keys of the map are merged on top
+// of the transferred value, e.g. renaming database to datastore and changing its host:
+//
+//	datastore:
+//	  __MOVE_FROM__: database
+//	  host: db.internal
+const (
+	directiveMerge    = "__MERGE__"
+	directiveValue    = "__VALUE__"
+	directiveMergeKey = "__MERGE_KEY__"
+	directiveBefore   = "__BEFORE__"
+	directiveAfter    = "__AFTER__"
+	directiveIndex    = "__INDEX__"
+	directiveMoveFrom = "__MOVE_FROM__"
+	directiveCopyFrom = "__COPY_FROM__"
+)
+
+// isDirectiveKey reports whether key is one of the merge directive keys.
+func isDirectiveKey(key string) bool {
+	switch key {
+	case directiveMerge, directiveValue, directiveMergeKey, directiveBefore, directiveAfter, directiveIndex,
+		directiveMoveFrom, directiveCopyFrom:
+		return true
+	}
+	return false
+}
+
+// isPositional reports whether a wrapper asks for a positional list operation.
+func isPositional(wrapper map[string]interface{}) bool {
+	switch wrapper[directiveMerge] {
+	case "prepend", "insert":
+		return true
+	}
+	for _, key := range []string{directiveBefore, directiveAfter, directiveIndex} {
+		if _, ok := wrapper[key]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readIndexDirective returns the "__INDEX__" directive of a wrapper as an int.
+func readIndexDirective(wrapper map[string]interface{}, path []string) (int, error) {
+	f, ok := toFloat(wrapper[directiveIndex])
+	if !ok || f != float64(int(f)) || f < 0 {
+		return 0, fmt.Errorf("merge directive %s at %q must be a non-negative integer", directiveIndex, joinPath(path))
+	}
+	return int(f), nil
+}
+
+// isWrapper reports whether v is a map wrapping a value with merge directives.
+func isWrapper(v interface{}) bool {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = m[directiveValue]
+	return ok
+}
+
+// patchValue returns the value a patch entry stores, looking through wrappers. Positional wrappers always produce a list.
+func patchValue(v interface{}) interface{} {
+	if !isWrapper(v) {
+		return v
+	}
+	wrapper := v.(map[string]interface{})
+	if isPositional(wrapper) {
+		return []interface{}{}
+	}
+	return wrapper[directiveValue]
+}
+
+// readDirective returns the string value of directive key in m, or "" if it isn't set.
+func readDirective(m map[string]interface{}, key string, path []string) (string, error) {
+	v, ok := m[key]
+	if !ok {
+		return "", nil
+	}
+	str, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("merge directive %s at %q must be a string", key, joinPath(path))
+	}
+	return str, nil
+}
+
+// mapDirective returns the "__MERGE__" directive of a map, which is either "merge" or "replace".
+func mapDirective(m map[string]interface{}, path []string) (string, error) {
+	directive, err := readDirective(m, directiveMerge, path)
+	if err != nil {
+		return "", err
+	}
+	switch directive {
+	case "", "merge":
+		return "merge", nil
+	case "replace":
+		return "replace", nil
+	default:
+		return "", fmt.Errorf("invalid merge directive %q for map at %q", directive, joinPath(path))
+	}
+}
+
+// listDirective translates the "__MERGE__" directive of a list wrapper into a list strategy. An empty strategy means the
+// directive didn't ask for one and the configured strategy should be used.
+func listDirective(wrapper map[string]interface{}, path []string) (string, string, error) {
+	directive, err := readDirective(wrapper, directiveMerge, path)
+	if err != nil {
+		return "", "", err
+	}
+	mergeKey, err := readDirective(wrapper, directiveMergeKey, path)
+	if err != nil {
+		return "", "", err
+	}
+
+	switch directive {
+	case "", "merge":
+		return "", mergeKey, nil
+	case "append":
+		return "preserve", mergeKey, nil
+	case "replace":
+		return "overwrite", mergeKey, nil
+	default:
+		return directive, mergeKey, nil
+	}
+}
+
+// prepare returns a copy of a patch value that is ready to be stored in the destination as is: wrappers are replaced by the
+// value they wrap, directive keys and keys set to the tombstone marker are removed from maps, list tombstones and tombstone
+// markers are removed from lists and escaped tombstone markers are unescaped, at any depth. There is nothing for a
+// tombstone to delete in a new value, but it must never reach the output.
+func (m *merger) prepare(v interface{}) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		if inner, ok := val[directiveValue]; ok {
+			return m.prepare(inner)
+		}
+		out := make(map[string]interface{}, len(val))
+		for k, item := range val {
+			if isDirectiveKey(k) || m.isTombstone(item) {
+				continue
+			}
+			out[k] = m.prepare(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, 0, len(val))
+		for _, item := range val {
+			if _, ok := m.listTombstone(item); ok || m.isTombstone(item) {
+				continue
+			}
+			out = append(out, m.prepare(item))
+		}
+		return out
+	default:
+		return m.unescapeTombstone(v)
+	}
+}
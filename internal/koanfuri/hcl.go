@@ -0,0 +1,166 @@
+package koanfuri
+
+import (
+	"fmt"
+
+	"github.com/hashicorp/hcl"
+	"github.com/hashicorp/hcl/hcl/ast"
+)
+
+// hclParser is a koanf.Parser for HCL documents that keeps blocks addressable by their type and labels. Decoding HCL
+// the usual way turns repeated blocks into lists of single key maps, which can't be told apart from nested blocks and
+// can only be merged as lists. Instead, a labeled block such as
+//
+//	service "web" {
+//	  port = 80
+//	}
+//
+// is loaded as the map service.web, so that blocks with the same type and labels are merged key by key like any other
+// map. Blocks with the same type and labels in one document are merged into each other. An unlabeled block is loaded
+// as a map, and an unlabeled block type repeated in one document as a list of maps. A block type used both with and
+// without labels, or with different numbers of labels, is an error.
+type hclParser struct{}
+
+// Unmarshal parses HCL bytes into a configuration map.
+func (p *hclParser) Unmarshal(data []byte) (map[string]interface{}, error) {
+	file, err := hcl.ParseBytes(data)
+	if err != nil {
+		return nil, err
+	}
+	list, ok := file.Node.(*ast.ObjectList)
+	if !ok {
+		return nil, fmt.Errorf("unexpected HCL document root %T", file.Node)
+	}
+	return decodeHCLBody(list)
+}
+
+// Marshal is not supported, HCL can only be used as an input.
+func (p *hclParser) Marshal(map[string]interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("HCL marshalling is not supported")
+}
+
+// decodeHCLBody decodes the attributes and blocks of a document or block body. A key must be used the same way
+// throughout the body: as an attribute, as an unlabeled block or as a block with a given number of labels. Anything else
+// is an error, since one use would overwrite the other.
+func decodeHCLBody(list *ast.ObjectList) (map[string]interface{}, error) {
+	body := make(map[string]interface{})
+	kinds := make(map[string]string)
+
+	for _, item := range list.Items {
+		keys := make([]string, len(item.Keys))
+		for i, key := range item.Keys {
+			keys[i] = fmt.Sprint(key.Token.Value())
+		}
+		if len(keys) == 0 {
+			continue
+		}
+
+		obj, isBlock := item.Val.(*ast.ObjectType)
+		isBlock = isBlock && !item.Assign.IsValid()
+		typ, labels := keys[0], keys[1:]
+
+		kind := "an attribute"
+		switch {
+		case !isBlock:
+		case len(labels) == 0:
+			kind = "an unlabeled block"
+		case len(labels) == 1:
+			kind = "a block with 1 label"
+		default:
+			kind = fmt.Sprintf("a block with %d labels", len(labels))
+		}
+		if existing, ok := kinds[typ]; ok && existing != kind {
+			return nil, fmt.Errorf("line %d: %q is used as %s and as %s", item.Pos().Line, typ, existing, kind)
+		}
+		kinds[typ] = kind
+
+		if !isBlock {
+			var value interface{}
+			if err := hcl.DecodeObject(&value, item.Val); err != nil {
+				return nil, fmt.Errorf("failed to decode %q: %w", joinPath(keys), err)
+			}
+			body[typ] = normalizeHCLValue(value)
+			continue
+		}
+
+		block, err := decodeHCLBody(obj.List)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(labels) == 0 {
+			// Repeated unlabeled blocks can't be matched to each other, so they are kept in order as a list
+			switch existing := body[typ].(type) {
+			case map[string]interface{}:
+				body[typ] = []interface{}{existing, block}
+			case []interface{}:
+				body[typ] = append(existing, block)
+			default:
+				body[typ] = block
+			}
+			continue
+		}
+
+		parent, ok := body[typ].(map[string]interface{})
+		if !ok {
+			parent = make(map[string]interface{})
+			body[typ] = parent
+		}
+		for _, label := range labels[:len(labels)-1] {
+			child, ok := parent[label].(map[string]interface{})
+			if !ok {
+				child = make(map[string]interface{})
+				parent[label] = child
+			}
+			parent = child
+		}
+		last := labels[len(labels)-1]
+		if existing, ok := parent[last].(map[string]interface{}); ok {
+			mergeHCLBlocks(block, existing)
+			continue
+		}
+		parent[last] = block
+	}
+	return body, nil
+}
+
+// mergeHCLBlocks merges the body of src into the body of dest, a block with the same type and labels.
+func mergeHCLBlocks(src, dest map[string]interface{}) {
+	for k, v := range src {
+		srcMap, srcOK := v.(map[string]interface{})
+		destMap, destOK := dest[k].(map[string]interface{})
+		if srcOK && destOK {
+			mergeHCLBlocks(srcMap, destMap)
+			continue
+		}
+		dest[k] = v
+	}
+}
+
+// normalizeHCLValue converts a decoded attribute value to the types the other parsers produce. HCL decodes objects as
+// lists of maps, so a list holding a single map is the map itself.
+func normalizeHCLValue(v interface{}) interface{} {
+	switch value := v.(type) {
+	case []map[string]interface{}:
+		if len(value) == 1 {
+			return normalizeHCLValue(value[0])
+		}
+		list := make([]interface{}, len(value))
+		for i, item := range value {
+			list[i] = normalizeHCLValue(item)
+		}
+		return list
+	case []interface{}:
+		for i, item := range value {
+			value[i] = normalizeHCLValue(item)
+		}
+		return value
+	case map[string]interface{}:
+		for k, item := range value {
+			value[k] = normalizeHCLValue(item)
+		}
+		return value
+	default:
+		return v
+	}
+}
@@ -0,0 +1,175 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHCLParser(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name: "labeled blocks",
+			data: `
+service "web" {
+  port = 80
+  check "http" {
+    path = "/"
+  }
+}
+service "api" {
+  port = 81
+}
+`,
+			expected: map[string]interface{}{
+				"service": map[string]interface{}{
+					"web": map[string]interface{}{"port": 80, "check": map[string]interface{}{"http": map[string]interface{}{"path": "/"}}},
+					"api": map[string]interface{}{"port": 81},
+				},
+			},
+		},
+		{
+			name: "multiple labels",
+			data: `
+job "a" "b" { count = 1 }
+job "a" "c" { count = 2 }
+`,
+			expected: map[string]interface{}{
+				"job": map[string]interface{}{
+					"a": map[string]interface{}{
+						"b": map[string]interface{}{"count": 1},
+						"c": map[string]interface{}{"count": 2},
+					},
+				},
+			},
+		},
+		{
+			name: "same labels in one document",
+			data: `
+service "web" { port = 80 }
+service "web" { tags = ["a"] }
+`,
+			expected: map[string]interface{}{
+				"service": map[string]interface{}{
+					"web": map[string]interface{}{"port": 80, "tags": []interface{}{"a"}},
+				},
+			},
+		},
+		{
+			name: "unlabeled blocks",
+			data: `
+server {
+  tls { enabled = true }
+}
+template { source = "a" }
+template { source = "b" }
+`,
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{"tls": map[string]interface{}{"enabled": true}},
+				"template": []interface{}{
+					map[string]interface{}{"source": "a"},
+					map[string]interface{}{"source": "b"},
+				},
+			},
+		},
+		{
+			name: "labeled and unlabeled blocks",
+			data: `
+service "web" { port = 80 }
+service { port = 1 }
+`,
+			err: `line 3: "service" is used as a block with 1 label and as an unlabeled block`,
+		},
+		{
+			name: "different numbers of labels",
+			data: `
+job "a" { count = 1 }
+job "a" "b" { count = 2 }
+`,
+			err: `line 3: "job" is used as a block with 1 label and as a block with 2 labels`,
+		},
+		{
+			name: "attribute and block",
+			data: `
+server {
+  tls = true
+  tls { enabled = true }
+}
+`,
+			err: `line 4: "tls" is used as an attribute and as an unlabeled block`,
+		},
+		{
+			name: "attributes",
+			data: `
+name = "app"
+tags = ["x", "y"]
+meta = { owner = "ops" }
+`,
+			expected: map[string]interface{}{
+				"name": "app",
+				"tags": []interface{}{"x", "y"},
+				"meta": map[string]interface{}{"owner": "ops"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := (&hclParser{}).Unmarshal([]byte(tt.data))
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, parsed)
+		})
+	}
+}
+
+func TestMergeHCLBlocks(t *testing.T) {
+	for _, strategy := range []string{"overwrite", "preserve"} {
+		t.Run(strategy, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.hcl", `
+datacenter = "dc1"
+service "web" {
+  port = 80
+  check "http" {
+    path     = "/health"
+    interval = "10s"
+  }
+}
+service "api" {
+  port = 81
+}
+`)
+			patch := newTestKoanfURI(t, "patch.hcl", `
+service "web" {
+  check "http" {
+    interval = "5s"
+  }
+}
+service "db" {
+  port = 5432
+}
+`)
+			require.NoError(t, k.Merge(patch, MergeOptions{Strategy: strategy}))
+
+			require.Equal(t, map[string]interface{}{
+				"datacenter": "dc1",
+				"service": map[string]interface{}{
+					"web": map[string]interface{}{
+						"port":  80,
+						"check": map[string]interface{}{"http": map[string]interface{}{"path": "/health", "interval": "5s"}},
+					},
+					"api": map[string]interface{}{"port": 81},
+					"db":  map[string]interface{}{"port": 5432},
+				},
+			}, k.konfig.Raw())
+		})
+	}
+}
@@ -0,0 +1,359 @@
+package koanfuri
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// jsonPatchOperation is a single operation of an RFC 6902 JSON Patch document.
+type jsonPatchOperation struct {
+	Op    string
+	Path  string
+	From  string
+	Value interface{}
+}
+
+// jsonPatchParser is a koanf.Parser for RFC 6902 JSON Patch documents. A JSON Patch is a list of operations rather than
+// a configuration tree, so the operations are stored on the KoanfURI and an empty configuration is handed to koanf.
+type jsonPatchParser struct {
+	k *KoanfURI
+}
+
+// Unmarshal parses the JSON Patch operations and stores them on the KoanfURI.
+func (p *jsonPatchParser) Unmarshal(data []byte) (map[string]interface{}, error) {
+	ops, err := parseJSONPatch(data)
+	if err != nil {
+		return nil, err
+	}
+	p.k.jsonPatch = ops
+	return map[string]interface{}{}, nil
+}
+
+// Marshal is not supported, JSON Patch can only be used as an input.
+func (p *jsonPatchParser) Marshal(map[string]interface{}) ([]byte, error) {
+	return nil, fmt.Errorf("cannot marshal configuration as a JSON Patch document")
+}
+
+// isJSONPatch reports whether data looks like an RFC 6902 JSON Patch document, i.e. a JSON array of operation objects.
+func isJSONPatch(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '[' {
+		return false
+	}
+	_, err := parseJSONPatch(trimmed)
+	return err == nil
+}
+
+// parseJSONPatch decodes and validates the operations of a JSON Patch document.
+func parseJSONPatch(data []byte) ([]jsonPatchOperation, error) {
+	var raw []map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid JSON Patch document: %w", err)
+	}
+
+	ops := make([]jsonPatchOperation, 0, len(raw))
+	for i, fields := range raw {
+		var op jsonPatchOperation
+		if err := decodeJSONPatchField(fields, "op", &op.Op); err != nil {
+			return nil, fmt.Errorf("JSON Patch operation %d: %w", i, err)
+		}
+		if err := decodeJSONPatchField(fields, "path", &op.Path); err != nil {
+			return nil, fmt.Errorf("JSON Patch operation %d: %w", i, err)
+		}
+
+		switch op.Op {
+		case "add", "replace", "test":
+			if _, ok := fields["value"]; !ok {
+				return nil, fmt.Errorf("JSON Patch operation %d: %q requires a value", i, op.Op)
+			}
+		case "move", "copy":
+			if err := decodeJSONPatchField(fields, "from", &op.From); err != nil {
+				return nil, fmt.Errorf("JSON Patch operation %d: %w", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("JSON Patch operation %d: unsupported op %q", i, op.Op)
+		}
+
+		if value, ok := fields["value"]; ok {
+			if err := json.Unmarshal(value, &op.Value); err != nil {
+				return nil, fmt.Errorf("JSON Patch operation %d: invalid value: %w", i, err)
+			}
+		}
+		ops = append(ops, op)
+	}
+
+	return ops, nil
+}
+
+// decodeJSONPatchField decodes the required string member name of an operation into out.
+func decodeJSONPatchField(fields map[string]json.RawMessage, name string, out *string) error {
+	value, ok := fields[name]
+	if !ok {
+		return fmt.Errorf("missing %q member", name)
+	}
+	if err := json.Unmarshal(value, out); err != nil {
+		return fmt.Errorf("%q member must be a string", name)
+	}
+	return nil
+}
+
+// applyJSONPatch applies the JSON Patch operations of other to the configuration. The operations are applied to a copy,
+// so the configuration is left untouched if any of them fails.
+func (k *KoanfURI) applyJSONPatch(other *KoanfURI) error {
+	var doc interface{} = k.konfig.Raw()
+
+	var changes []provenanceChange
+	for i, op := range other.jsonPatch {
+		var err error
+		if doc, err = op.apply(doc); err != nil {
+			return fmt.Errorf("JSON Patch operation %d (%s %s) failed: %w", i, op.Op, op.Path, err)
+		}
+		changes = append(changes, op.changes(doc)...)
+	}
+
+	root, ok := doc.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("JSON Patch must leave an object at the document root")
+	}
+
+	if err := k.reload(root); err != nil {
+		return fmt.Errorf("failed to load patched configuration: %w", err)
+	}
+	k.trackChanges(other, changes)
+	return nil
+}
+
+// changes returns the provenance changes made by the operation, given the document after it was applied.
+func (op jsonPatchOperation) changes(doc interface{}) []provenanceChange {
+	var changes []provenanceChange
+	switch op.Op {
+	case "add", "replace", "copy", "move", "remove":
+		if op.Op == "move" {
+			changes = append(changes, jsonPointerChange(doc, op.From))
+		}
+		changes = append(changes, jsonPointerChange(doc, op.Path))
+	}
+	return changes
+}
+
+// jsonPointerChange converts a JSON Pointer into a provenance change. Lists are leaves for provenance, so a pointer into a
+// list changes the list itself.
+func jsonPointerChange(doc interface{}, pointer string) provenanceChange {
+	tokens, _ := parseJSONPointer(pointer)
+
+	var path []string
+	for _, token := range tokens {
+		m, ok := doc.(map[string]interface{})
+		if !ok {
+			break
+		}
+		path = append(path, token)
+		if doc, ok = m[token]; !ok {
+			return provenanceChange{path: path, removed: true}
+		}
+	}
+	return provenanceChange{path: path}
+}
+
+// apply applies the operation to doc and returns the resulting document.
+func (op jsonPatchOperation) apply(doc interface{}) (interface{}, error) {
+	path, err := parseJSONPointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add":
+		return jsonPointerAdd(doc, path, deepCopy(op.Value))
+	case "remove":
+		return jsonPointerRemove(doc, path)
+	case "replace":
+		if _, err := jsonPointerGet(doc, path); err != nil {
+			return nil, err
+		}
+		if len(path) == 0 {
+			return deepCopy(op.Value), nil
+		}
+		if doc, err = jsonPointerRemove(doc, path); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, deepCopy(op.Value))
+	case "move", "copy":
+		from, err := parseJSONPointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+		value, err := jsonPointerGet(doc, from)
+		if err != nil {
+			return nil, err
+		}
+		if op.Op == "copy" {
+			return jsonPointerAdd(doc, path, deepCopy(value))
+		}
+		if len(from) < len(path) && slices.Equal(from, path[:len(from)]) {
+			return nil, fmt.Errorf("cannot move %q into one of its children", op.From)
+		}
+		if doc, err = jsonPointerRemove(doc, from); err != nil {
+			return nil, err
+		}
+		return jsonPointerAdd(doc, path, value)
+	case "test":
+		value, err := jsonPointerGet(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !valuesEqual(value, op.Value) {
+			return nil, fmt.Errorf("value at %q is %v, expected %v", op.Path, value, op.Value)
+		}
+		return doc, nil
+	default:
+		return nil, fmt.Errorf("unsupported op %q", op.Op)
+	}
+}
+
+// parseJSONPointer splits an RFC 6901 JSON Pointer into its unescaped reference tokens.
+func parseJSONPointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid JSON Pointer %q", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+// jsonPointerIndex parses an array index token. allowEnd permits the index one past the last element, including "-".
+func jsonPointerIndex(token string, length int, allowEnd bool) (int, error) {
+	if token == "-" && allowEnd {
+		return length, nil
+	}
+	if token == "" || (len(token) > 1 && token[0] == '0') || strings.TrimLeft(token, "0123456789") != "" {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	idx, err := strconv.Atoi(token)
+	if err != nil {
+		return 0, fmt.Errorf("invalid array index %q", token)
+	}
+	if idx > length || (idx == length && !allowEnd) {
+		return 0, fmt.Errorf("array index %d out of range", idx)
+	}
+	return idx, nil
+}
+
+// jsonPointerGet returns the value referenced by path.
+func jsonPointerGet(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			value, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("key %q does not exist", token)
+			}
+			doc = value
+		case []interface{}:
+			idx, err := jsonPointerIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[idx]
+		default:
+			return nil, fmt.Errorf("cannot reference %q in a scalar value", token)
+		}
+	}
+	return doc, nil
+}
+
+// jsonPointerUpdate calls fn with the container holding the last token of path and stores the container fn returns,
+// so that lists can grow or shrink. It returns the updated document.
+func jsonPointerUpdate(doc interface{}, path []string, fn func(container interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+
+	switch node := doc.(type) {
+	case map[string]interface{}:
+		child, ok := node[path[0]]
+		if !ok {
+			return nil, fmt.Errorf("key %q does not exist", path[0])
+		}
+		updated, err := jsonPointerUpdate(child, path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[path[0]] = updated
+		return node, nil
+	case []interface{}:
+		idx, err := jsonPointerIndex(path[0], len(node), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := jsonPointerUpdate(node[idx], path[1:], fn)
+		if err != nil {
+			return nil, err
+		}
+		node[idx] = updated
+		return node, nil
+	default:
+		return nil, fmt.Errorf("cannot reference %q in a scalar value", path[0])
+	}
+}
+
+// jsonPointerAdd adds value at path, inserting into lists and replacing existing object members.
+func jsonPointerAdd(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return jsonPointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			node[token] = value
+			return node, nil
+		case []interface{}:
+			idx, err := jsonPointerIndex(token, len(node), true)
+			if err != nil {
+				return nil, err
+			}
+			node = append(node, nil)
+			copy(node[idx+1:], node[idx:])
+			node[idx] = value
+			return node, nil
+		default:
+			return nil, fmt.Errorf("cannot add %q to a scalar value", token)
+		}
+	})
+}
+
+// jsonPointerRemove removes the value at path.
+func jsonPointerRemove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("cannot remove the document root")
+	}
+	return jsonPointerUpdate(doc, path, func(container interface{}, token string) (interface{}, error) {
+		switch node := container.(type) {
+		case map[string]interface{}:
+			if _, ok := node[token]; !ok {
+				return nil, fmt.Errorf("key %q does not exist", token)
+			}
+			delete(node, token)
+			return node, nil
+		case []interface{}:
+			idx, err := jsonPointerIndex(token, len(node), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(node[:idx], node[idx+1:]...), nil
+		default:
+			return nil, fmt.Errorf("cannot remove %q from a scalar value", token)
+		}
+	})
+}
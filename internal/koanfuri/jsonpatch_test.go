@@ -0,0 +1,132 @@
+package koanfuri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testJSONPatchBase = `
+server:
+  host: localhost
+  port: 8080
+  plugins: [auth, logger]
+legacy:
+  db: postgres
+`
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		patch       string
+		expected    map[string]interface{}
+		expectError bool
+	}{
+		{
+			name:  "add, replace and remove",
+			patch: `[{"op": "add", "path": "/server/tls", "value": true}, {"op": "replace", "path": "/server/port", "value": 9090}, {"op": "remove", "path": "/server/host"}]`,
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{"port": float64(9090), "tls": true, "plugins": []interface{}{"auth", "logger"}},
+				"legacy": map[string]interface{}{"db": "postgres"},
+			},
+		},
+		{
+			name:  "list insert, append and remove",
+			patch: `[{"op": "add", "path": "/server/plugins/0", "value": "cors"}, {"op": "add", "path": "/server/plugins/-", "value": "metrics"}, {"op": "remove", "path": "/server/plugins/2"}]`,
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{"host": "localhost", "port": 8080, "plugins": []interface{}{"cors", "auth", "metrics"}},
+				"legacy": map[string]interface{}{"db": "postgres"},
+			},
+		},
+		{
+			name:  "move and copy",
+			patch: `[{"op": "move", "from": "/legacy/db", "path": "/database"}, {"op": "copy", "from": "/server/port", "path": "/admin_port"}]`,
+			expected: map[string]interface{}{
+				"server":     map[string]interface{}{"host": "localhost", "port": 8080, "plugins": []interface{}{"auth", "logger"}},
+				"legacy":     map[string]interface{}{},
+				"database":   "postgres",
+				"admin_port": 8080,
+			},
+		},
+		{
+			name:  "passing test",
+			patch: `[{"op": "test", "path": "/server/port", "value": 8080}, {"op": "test", "path": "/server/plugins", "value": ["auth", "logger"]}]`,
+			expected: map[string]interface{}{
+				"server": map[string]interface{}{"host": "localhost", "port": 8080, "plugins": []interface{}{"auth", "logger"}},
+				"legacy": map[string]interface{}{"db": "postgres"},
+			},
+		},
+		{
+			name:        "failing test",
+			patch:       `[{"op": "remove", "path": "/legacy"}, {"op": "test", "path": "/server/port", "value": 9090}]`,
+			expectError: true,
+		},
+		{
+			name:        "missing parent",
+			patch:       `[{"op": "add", "path": "/missing/key", "value": 1}]`,
+			expectError: true,
+		},
+		{
+			name:        "replace missing key",
+			patch:       `[{"op": "replace", "path": "/server/missing", "value": 1}]`,
+			expectError: true,
+		},
+		{
+			name:        "move into own child",
+			patch:       `[{"op": "move", "from": "/server", "path": "/server/nested"}]`,
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", testJSONPatchBase)
+			patch := newTestKoanfURI(t, "patch.json", tt.patch)
+			require.True(t, patch.IsJSONPatch())
+
+			err := k.Merge(patch, MergeOptions{Strategy: "overwrite"})
+			if tt.expectError {
+				require.Error(t, err)
+				// A failed patch must leave the configuration untouched
+				require.Equal(t, "postgres", k.GetKonfig().String("legacy.db"))
+				return
+			}
+
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, k.GetKonfig().Raw())
+		})
+	}
+}
+
+func TestJSONPointerEscaping(t *testing.T) {
+	k := newTestKoanfURI(t, "base.json", `{"paths": {"/api": {"a~b": 1}}}`)
+	patch := newTestKoanfURI(t, "patch.json", `[{"op": "replace", "path": "/paths/~1api/a~0b", "value": 2}]`)
+
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, map[string]interface{}{"/api": map[string]interface{}{"a~b": float64(2)}}, k.GetKonfig().Raw()["paths"])
+}
+
+func TestJSONPatchDetection(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	patchFile := filepath.Join(tmpDir, "ops.json")
+	err := os.WriteFile(patchFile, []byte(`[{"op": "remove", "path": "/key"}]`), 0644)
+	require.NoError(t, err)
+
+	hintedFile := filepath.Join(tmpDir, "ops.txt")
+	err = os.WriteFile(hintedFile, []byte(`[{"op": "remove", "path": "/key"}]`), 0644)
+	require.NoError(t, err)
+
+	for _, uri := range []string{patchFile, "file://" + patchFile, "file+jsonpatch://" + hintedFile, "jsonpatch+file://" + hintedFile} {
+		k, err := NewKoanfURI(uri)
+		require.NoError(t, err, uri)
+		require.Equal(t, "jsonpatch", k.GetDataFormat(), uri)
+		require.True(t, k.IsJSONPatch(), uri)
+	}
+
+	require.False(t, isJSONPatch([]byte(`{"op": "remove", "path": "/key"}`)))
+	require.False(t, isJSONPatch([]byte(`[{"op": "explode", "path": "/key"}]`)))
+	require.False(t, isJSONPatch([]byte(`[1, 2, 3]`)))
+}
@@ -0,0 +1,54 @@
+package koanfuri
+
+import "strings"
+
+// splitPath splits a dot separated key path such as "server.plugins" into its segments. A segment holding dots, such as
+// a Kubernetes label, is written in double quotes: `metadata.labels."app.kubernetes.io/name"`. Inside quotes a
+// backslash escapes the next character. An unterminated quote runs to the end of the path.
+func splitPath(keyPath string) []string {
+	if keyPath == "" {
+		return nil
+	}
+
+	var segments []string
+	var segment strings.Builder
+	quoted, escaped := false, false
+	for i := 0; i < len(keyPath); i++ {
+		c := keyPath[i]
+		switch {
+		case escaped:
+			segment.WriteByte(c)
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"' && (quoted || segment.Len() == 0):
+			quoted = !quoted
+		case c == '.' && !quoted:
+			segments = append(segments, segment.String())
+			segment.Reset()
+		default:
+			segment.WriteByte(c)
+		}
+	}
+	return append(segments, segment.String())
+}
+
+// joinPath joins key path segments back into their dot separated form, quoting segments that splitPath would
+// otherwise split or unquote.
+func joinPath(path []string) string {
+	segments := make([]string, len(path))
+	for i, segment := range path {
+		if strings.Contains(segment, ".") || strings.HasPrefix(segment, `"`) {
+			segment = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(segment) + `"`
+		}
+		segments[i] = segment
+	}
+	return strings.Join(segments, ".")
+}
+
+// childPath returns a new path with key appended to path, leaving path untouched.
+func childPath(path []string, key string) []string {
+	child := make([]string, len(path), len(path)+1)
+	copy(child, path)
+	return append(child, key)
+}
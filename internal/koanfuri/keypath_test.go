@@ -0,0 +1,95 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPath(t *testing.T) {
+	tests := []struct {
+		keyPath  string
+		expected []string
+	}{
+		{keyPath: "", expected: nil},
+		{keyPath: "server", expected: []string{"server"}},
+		{keyPath: "server.plugins", expected: []string{"server", "plugins"}},
+		{keyPath: `metadata.labels."app.kubernetes.io/name"`, expected: []string{"metadata", "labels", "app.kubernetes.io/name"}},
+		{keyPath: `"example.com".port`, expected: []string{"example.com", "port"}},
+		{keyPath: `a."say \"hi\".\\"`, expected: []string{"a", `say "hi".\`}},
+		{keyPath: `a.b"c`, expected: []string{"a", `b"c`}},
+		{keyPath: `a."b.c`, expected: []string{"a", "b.c"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.keyPath, func(t *testing.T) {
+			require.Equal(t, tt.expected, splitPath(tt.keyPath))
+		})
+	}
+}
+
+func TestJoinPath(t *testing.T) {
+	for _, path := range [][]string{
+		{"server", "plugins"},
+		{"metadata", "labels", "app.kubernetes.io/name"},
+		{"a", `say "hi".\`},
+		{`"quoted"`, "b"},
+		{"a", `b"c`},
+	} {
+		require.Equal(t, path, splitPath(joinPath(path)))
+	}
+	require.Equal(t, `metadata.labels."app.kubernetes.io/name"`, joinPath([]string{"metadata", "labels", "app.kubernetes.io/name"}))
+}
+
+func TestMergeDottedKeys(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", `
+metadata:
+  labels:
+    app.kubernetes.io/name: web
+    app.kubernetes.io/version: "1.0"
+hosts:
+  example.com:
+    port: 80
+example.org: 443
+`)
+	patch := newTestKoanfURI(t, "patch.json", `{
+  "metadata": {"labels": {"app.kubernetes.io/version": "1.1", "app.kubernetes.io/part-of": "shop"}},
+  "hosts": {"example.com": {"tls": true}},
+  "example.org": 8443
+}`)
+	rules := []MergeRule{{Path: `metadata.labels."app.kubernetes.io/name"`, Strategy: "preserve"}}
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite", Rules: rules}))
+
+	require.Equal(t, map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"labels": map[string]interface{}{
+				"app.kubernetes.io/name":    "web",
+				"app.kubernetes.io/version": "1.1",
+				"app.kubernetes.io/part-of": "shop",
+			},
+		},
+		"hosts": map[string]interface{}{
+			"example.com": map[string]interface{}{"port": 80, "tls": true},
+		},
+		"example.org": float64(8443),
+	}, k.konfig.Raw())
+
+	require.Equal(t, map[string]string{
+		`metadata.labels."app.kubernetes.io/name"`:    "file:///base.yaml",
+		`metadata.labels."app.kubernetes.io/version"`: "file:///patch.json",
+		`metadata.labels."app.kubernetes.io/part-of"`: "file:///patch.json",
+		`hosts."example.com".port`:                    "file:///base.yaml",
+		`hosts."example.com".tls`:                     "file:///patch.json",
+		`"example.org"`:                               "file:///patch.json",
+	}, origins(k))
+
+	parser, err := k.getParser()
+	require.NoError(t, err)
+	data, err := k.konfig.Marshal(parser)
+	require.NoError(t, err)
+	require.Contains(t, string(data), "app.kubernetes.io/name: web")
+
+	moved := newTestKoanfURI(t, "move.yaml", "metadata:\n  labels:\n    name:\n      __MOVE_FROM__: 'metadata.labels.\"app.kubernetes.io/name\"'\n")
+	require.NoError(t, k.Merge(moved, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, "web", k.konfig.Raw()["metadata"].(map[string]interface{})["labels"].(map[string]interface{})["name"])
+}
@@ -1,17 +1,20 @@
 package koanfuri
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
-	"github.com/knadh/koanf/parsers/hcl"
 	"github.com/knadh/koanf/parsers/json"
 	"github.com/knadh/koanf/parsers/toml"
 	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/providers/rawbytes"
 	"github.com/knadh/koanf/v2"
 )
@@ -21,13 +24,26 @@ type KoanfURI struct {
 	konfig     *koanf.Koanf
 	uri        *url.URL
 	dataFormat string
+	jsonPatch  []jsonPatchOperation
+	provenance *provenanceTree
+	locked     []string
+	assertions []assertion
+	overrides  []override
+	when       string
+	options    InputOptions
 }
 
-// NewKoanfURI creates a new KoanfURI instance from the given URI string
-func NewKoanfURI(uri string) (*KoanfURI, error) {
+// NewKoanfURI creates a new KoanfURI instance from the given URI string, which may be followed by input options (see
+// InputOptions).
+func NewKoanfURI(input string) (*KoanfURI, error) {
+	uri, options, err := parseInputOptions(input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input %q: %w", input, err)
+	}
+
 	// Handle stdin special cases
 	if uri == "stdin" || uri == "-" {
-		return newKoanfURIFromStdin()
+		return newKoanfURIFromStdin(options)
 	}
 
 	// If the URI doesn't have a scheme, treat it as a file path
@@ -47,19 +63,39 @@ func NewKoanfURI(uri string) (*KoanfURI, error) {
 	}
 
 	k := &KoanfURI{
-		konfig: koanf.New("."),
-		uri:    parsedURI,
+		konfig:  koanf.New("."),
+		uri:     parsedURI,
+		options: options,
 	}
 
 	// Check for scheme hint
 	if strings.Contains(parsedURI.Scheme, "+") {
 		parts := strings.SplitN(parsedURI.Scheme, "+", 2)
+		// The JSON Patch hint may also lead the scheme, e.g. jsonpatch+file://
+		if parts[0] == "jsonpatch" {
+			parts[0], parts[1] = parts[1], parts[0]
+		}
 		parsedURI.Scheme = parts[0]
 		k.dataFormat = parts[1]
 	}
+	if options.Format != "" {
+		if k.dataFormat != "" && k.dataFormat != options.Format {
+			return nil, fmt.Errorf("invalid input %q: format %s conflicts with scheme hint %s", input, options.Format, k.dataFormat)
+		}
+		k.dataFormat = options.Format
+	}
 
 	// Load the configuration based on the scheme
 	if err := k.load(); err != nil {
+		if options.Optional && errors.Is(err, fs.ErrNotExist) {
+			slog.Info("skipping missing optional input", "uri", k.String())
+			k.konfig = koanf.New(".")
+			k.initProvenance()
+			return k, nil
+		}
+		return nil, err
+	}
+	if err := k.prepareDocument(); err != nil {
 		return nil, err
 	}
 
@@ -67,21 +103,26 @@ func NewKoanfURI(uri string) (*KoanfURI, error) {
 }
 
 // newKoanfURIFromStdin creates a new KoanfURI instance reading from stdin
-func newKoanfURIFromStdin() (*KoanfURI, error) {
+func newKoanfURIFromStdin(options InputOptions) (*KoanfURI, error) {
 	data, err := io.ReadAll(os.Stdin)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read from stdin: %w", err)
 	}
 
 	k := &KoanfURI{
-		konfig: koanf.New("."),
-		uri:    &url.URL{Scheme: "stdin"},
+		konfig:     koanf.New("."),
+		uri:        &url.URL{Scheme: "stdin"},
+		dataFormat: options.Format,
+		options:    options,
 	}
 
 	// Parse the data
 	if err := k.parseData(data); err != nil {
 		return nil, err
 	}
+	if err := k.prepareDocument(); err != nil {
+		return nil, err
+	}
 
 	return k, nil
 }
@@ -143,7 +184,9 @@ func (k *KoanfURI) getParser() (koanf.Parser, error) {
 	case "toml":
 		return toml.Parser(), nil
 	case "hcl":
-		return hcl.Parser(true), nil
+		return &hclParser{}, nil
+	case "jsonpatch":
+		return &jsonPatchParser{k: k}, nil
 	default:
 		return nil, fmt.Errorf("unsupported format: %s", k.dataFormat)
 	}
@@ -151,6 +194,11 @@ func (k *KoanfURI) getParser() (koanf.Parser, error) {
 
 // detectFormat attempts to determine the configuration format by trying each parser
 func (k *KoanfURI) detectFormat(data []byte) string {
+	// JSON Patch documents are JSON arrays, which none of the configuration parsers accept
+	if isJSONPatch(data) {
+		return "jsonpatch"
+	}
+
 	// First try to detect from file extension if available
 	if k.uri.Path != "" {
 		ext := strings.ToLower(filepath.Ext(k.uri.Path))
@@ -170,7 +218,7 @@ func (k *KoanfURI) detectFormat(data []byte) string {
 		{"json", json.Parser()},
 		{"toml", toml.Parser()}, // Try TOML before YAML
 		{"yaml", yaml.Parser()},
-		{"hcl", hcl.Parser(true)},
+		{"hcl", &hclParser{}},
 	}
 
 	for _, p := range parsers {
@@ -203,3 +251,64 @@ func (k *KoanfURI) GetDataFormat() string {
 func (k *KoanfURI) GetURI() *url.URL {
 	return k.uri
 }
+
+// String returns the URI the KoanfURI was loaded from
+func (k *KoanfURI) String() string {
+	if k.uri.Scheme == "stdin" {
+		return "stdin"
+	}
+	return k.uri.String()
+}
+
+// IsJSONPatch reports whether the KoanfURI was loaded from an RFC 6902 JSON Patch document
+func (k *KoanfURI) IsJSONPatch() bool {
+	return k.jsonPatch != nil
+}
+
+// PatchDirectives returns the top level directives of the document that only take effect when it is merged as a
+// patch, __ASSERT__ and __WHEN__, so that callers can reject them on other inputs instead of ignoring them.
+func (k *KoanfURI) PatchDirectives() []string {
+	var directives []string
+	if k.assertions != nil {
+		directives = append(directives, directiveAssert)
+	}
+	if k.when != "" {
+		directives = append(directives, directiveWhen)
+	}
+	return directives
+}
+
+// extractDirectives removes the top level directives that apply to the whole document, such as locked keys,
+// assertions and conditions, from the configuration and keeps them on the KoanfURI.
+func (k *KoanfURI) extractDirectives() error {
+	if err := k.extractLocks(); err != nil {
+		return err
+	}
+	if err := k.extractAssertions(); err != nil {
+		return err
+	}
+	return k.extractCondition()
+}
+
+// prepareDocument finishes loading a document: it extracts the top level directives, mounts the document and starts
+// tracking provenance.
+func (k *KoanfURI) prepareDocument() error {
+	if err := k.extractDirectives(); err != nil {
+		return err
+	}
+	if err := k.mount(); err != nil {
+		return err
+	}
+	k.initProvenance()
+	return nil
+}
+
+// reload replaces the configuration with root. Keys are loaded as they are, without splitting them on the delimiter.
+func (k *KoanfURI) reload(root map[string]interface{}) error {
+	konfig := koanf.New(".")
+	if err := konfig.Load(confmap.Provider(root, ""), nil); err != nil {
+		return err
+	}
+	k.konfig = konfig
+	return nil
+}
@@ -0,0 +1,223 @@
+package koanfuri
+
+import (
+	"fmt"
+	"strings"
+)
+
+// defaultTombstoneMarker is the value that deletes a key when set in a patch, unless MergeOptions.TombstoneMarker names
+// another one. Inside a list, a map holding only the marker key removes the items it matches from the destination list,
+// e.g. {"__TOMBSTONE__": "10.0.0.0/8"} or {"__TOMBSTONE__": "auth"} for a list of maps keyed by name. A map value matches
+// maps whose fields include all of its fields.
+//
+// A string made of a backslash followed by the marker sets the marker itself as a literal value. Only one leading backslash
+// is removed, so `\__TOMBSTONE__` becomes `__TOMBSTONE__` and `\\__TOMBSTONE__` becomes `\__TOMBSTONE__`.
+const defaultTombstoneMarker = "__TOMBSTONE__"
+
+// tombstoneMarker returns the tombstone marker in effect for this merge.
+func (m *merger) tombstoneMarker() string {
+	if m.opts.TombstoneMarker != "" {
+		return m.opts.TombstoneMarker
+	}
+	return defaultTombstoneMarker
+}
+
+// isTombstone reports whether v is the tombstone marker.
+func (m *merger) isTombstone(v interface{}) bool {
+	str, ok := v.(string)
+	return ok && str == m.tombstoneMarker()
+}
+
+// unescapeTombstone removes one leading backslash from escaped tombstone markers and returns any other value unchanged.
+func (m *merger) unescapeTombstone(v interface{}) interface{} {
+	str, ok := v.(string)
+	if ok && strings.HasPrefix(str, `\`) && strings.TrimLeft(str, `\`) == m.tombstoneMarker() {
+		return str[1:]
+	}
+	return v
+}
+
+// listTombstone returns what a list tombstone item matches, and whether item is a list tombstone at all.
+func (m *merger) listTombstone(item interface{}) (interface{}, bool) {
+	itemMap, ok := item.(map[string]interface{})
+	if !ok || len(itemMap) != 1 {
+		return nil, false
+	}
+	match, ok := itemMap[m.tombstoneMarker()]
+	return match, ok
+}
+
+// removeListItems splits the list tombstones out of src and removes the items they match from dest. It returns the
+// remaining patch items and a new destination list.
+func (m *merger) removeListItems(src, dest []interface{}, mergeKey string) ([]interface{}, []interface{}) {
+	var remaining, matches []interface{}
+	for _, item := range src {
+		if match, ok := m.listTombstone(item); ok {
+			matches = append(matches, match)
+			continue
+		}
+		remaining = append(remaining, item)
+	}
+	if len(matches) == 0 {
+		return src, dest
+	}
+
+	kept := make([]interface{}, 0, len(dest))
+	for _, item := range dest {
+		removed := false
+		for _, match := range matches {
+			if listItemMatches(item, match, mergeKey) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			kept = append(kept, item)
+		}
+	}
+	return remaining, kept
+}
+
+// listItemMatches reports whether a list item is matched by a list tombstone. Map matches select maps containing all of
+// their fields, other matches select maps by their mergeKey field and scalars by value.
+func listItemMatches(item, match interface{}, mergeKey string) bool {
+	itemMap, isMap := item.(map[string]interface{})
+
+	if matchMap, ok := match.(map[string]interface{}); ok {
+		if !isMap {
+			return false
+		}
+		for k, v := range matchMap {
+			if other, exists := itemMap[k]; !exists || !valuesEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	}
+
+	if isMap {
+		v, exists := itemMap[mergeKey]
+		return exists && valuesEqual(v, match)
+	}
+	if _, isList := item.([]interface{}); isList {
+		return false
+	}
+	return valuesEqual(item, match)
+}
+
+// mergePositional applies a positional list operation (see directives.go) from wrapper to the dest list and returns the
+// resulting list. A missing destination list is treated as an empty one.
+func (m *merger) mergePositional(wrapper map[string]interface{}, dest interface{}, path []string) (interface{}, error) {
+	op, err := readDirective(wrapper, directiveMerge, path)
+	if err != nil {
+		return nil, err
+	}
+
+	destSlice, _ := dest.([]interface{})
+	list := make([]interface{}, len(destSlice))
+	copy(list, destSlice)
+
+	switch op {
+	case "prepend":
+		return append(m.wrappedItems(wrapper), list...), nil
+	case "insert":
+		idx, err := m.insertIndex(wrapper, list, path)
+		if err != nil {
+			return nil, err
+		}
+		items := m.wrappedItems(wrapper)
+		mergedSlice := make([]interface{}, 0, len(list)+len(items))
+		mergedSlice = append(mergedSlice, list[:idx]...)
+		mergedSlice = append(mergedSlice, items...)
+		return append(mergedSlice, list[idx:]...), nil
+	case "replace":
+		idx, err := readIndexDirective(wrapper, path)
+		if err != nil {
+			return nil, err
+		}
+		if idx >= len(list) {
+			return nil, fmt.Errorf("merge directive at %q: index %d out of range for list of length %d", joinPath(path), idx, len(list))
+		}
+		list[idx] = m.prepare(wrapper[directiveValue])
+		return list, nil
+	default:
+		return nil, fmt.Errorf("merge directive %q at %q does not support %s, %s or %s", op, joinPath(path), directiveBefore, directiveAfter, directiveIndex)
+	}
+}
+
+// wrappedItems returns the items held by a positional wrapper. A wrapped value that isn't a list is a single item.
+func (m *merger) wrappedItems(wrapper map[string]interface{}) []interface{} {
+	items, ok := wrapper[directiveValue].([]interface{})
+	if !ok {
+		items = []interface{}{wrapper[directiveValue]}
+	}
+	return m.prepare(items).([]interface{})
+}
+
+// insertIndex returns where an insert operation places its items in list, based on exactly one of the "__BEFORE__",
+// "__AFTER__" and "__INDEX__" directives.
+func (m *merger) insertIndex(wrapper map[string]interface{}, list []interface{}, path []string) (int, error) {
+	before, hasBefore := wrapper[directiveBefore]
+	after, hasAfter := wrapper[directiveAfter]
+	_, hasIndex := wrapper[directiveIndex]
+
+	count := 0
+	for _, has := range []bool{hasBefore, hasAfter, hasIndex} {
+		if has {
+			count++
+		}
+	}
+	if count != 1 {
+		return 0, fmt.Errorf("merge directive insert at %q requires exactly one of %s, %s or %s", joinPath(path), directiveBefore, directiveAfter, directiveIndex)
+	}
+
+	if hasIndex {
+		idx, err := readIndexDirective(wrapper, path)
+		if err != nil {
+			return 0, err
+		}
+		if idx > len(list) {
+			return 0, fmt.Errorf("merge directive at %q: index %d out of range for list of length %d", joinPath(path), idx, len(list))
+		}
+		return idx, nil
+	}
+
+	mergeKey, err := readDirective(wrapper, directiveMergeKey, path)
+	if err != nil {
+		return 0, err
+	}
+	if mergeKey == "" {
+		_, mergeKey = m.listStrategy(path)
+	}
+
+	anchor := before
+	if hasAfter {
+		anchor = after
+	}
+	idx := findItem(list, mergeKey, anchor)
+	if idx < 0 {
+		return 0, fmt.Errorf("merge directive at %q: no list item matches %v", joinPath(path), anchor)
+	}
+	if hasAfter {
+		idx++
+	}
+	return idx, nil
+}
+
+// findItem returns the index of the first item in list matching value: a map whose mergeKey field matches it or a scalar
+// equal to it. Returns -1 if there is none.
+func findItem(list []interface{}, mergeKey string, value interface{}) int {
+	if idx := findKeyedItem(list, mergeKey, value); idx >= 0 {
+		return idx
+	}
+	for i, item := range list {
+		switch item.(type) {
+		case map[string]interface{}, []interface{}:
+			continue
+		}
+		if valuesEqual(item, value) {
+			return i
+		}
+	}
+	return -1
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"io/fs"
 	"net/http"
 	"os"
 	"path/filepath"
@@ -232,6 +233,9 @@ func (k *KoanfURI) loadHTTP() error {
 		return fmt.Errorf("failed to fetch URL: %w", err)
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return fmt.Errorf("failed to fetch URL: %s: %w", resp.Status, fs.ErrNotExist)
+	}
 
 	data, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -0,0 +1,121 @@
+package koanfuri
+
+import (
+	"fmt"
+	gopath "path"
+	"sort"
+)
+
+// directiveLocked is a top level key listing the key paths of a document that later layers may not change, e.g.
+//
+//	__LOCKED__:
+//	  - security.tls.min_version
+//	  - "security.**"
+//
+// Paths use the same patterns as MergeRule and lock everything below them. The key is removed when the document is
+// loaded, and the locks apply to every patch merged after the document.
+const directiveLocked = "__LOCKED__"
+
+// extractLocks removes the locked key paths from the document and keeps them on the KoanfURI.
+func (k *KoanfURI) extractLocks() error {
+	if !k.konfig.Exists(directiveLocked) {
+		return nil
+	}
+	locked, err := parseLocks(k.konfig.Get(directiveLocked))
+	if err != nil {
+		return fmt.Errorf("invalid %s in %s: %w", directiveLocked, k, err)
+	}
+	k.konfig.Delete(directiveLocked)
+	k.locked = locked
+	return nil
+}
+
+// rawWithLocks returns the configuration with the locked key paths put back under directiveLocked, for results that
+// are written out as documents again.
+func (k *KoanfURI) rawWithLocks() map[string]interface{} {
+	raw := k.konfig.Raw()
+	if k.locked == nil {
+		return raw
+	}
+	locked := make([]interface{}, len(k.locked))
+	for i, pattern := range k.locked {
+		locked[i] = pattern
+	}
+	raw[directiveLocked] = locked
+	return raw
+}
+
+// LoadLockedKeys loads key paths that patches may not change from the "locked" list of the document at uri. Any URI
+// accepted by NewKoanfURI can be used, e.g.
+//
+//	locked:
+//	  - security.tls.min_version
+//	  - "security.**"
+func LoadLockedKeys(uri string) ([]string, error) {
+	k, err := NewKoanfURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	locked, err := parseLocks(k.konfig.Get("locked"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse locked keys: %w", err)
+	}
+	return locked, nil
+}
+
+// parseLocks validates a list of locked key path patterns.
+func parseLocks(v interface{}) ([]string, error) {
+	items, ok := v.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("locked keys must be a list of key paths")
+	}
+
+	locked := make([]string, 0, len(items))
+	for i, item := range items {
+		pattern, ok := item.(string)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("locked key %d must be a non-empty key path", i)
+		}
+		if _, err := gopath.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("locked key %d has an invalid path %q: %w", i, pattern, err)
+		}
+		locked = append(locked, pattern)
+	}
+	return locked, nil
+}
+
+// isLocked reports whether path, or any key above it, matches one of the locked patterns.
+func isLocked(locked []string, path []string) bool {
+	for _, pattern := range locked {
+		for i := range path {
+			if matchPath(pattern, path[:i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// lockedChange returns the first locked key path whose value differs between before and after, and whether there is one.
+func lockedChange(locked []string, before, after map[string]interface{}) (string, bool) {
+	var changed []string
+	check := func(path []string, _ interface{}) {
+		if !isLocked(locked, path) {
+			return
+		}
+		a, inBefore := lookupPath(before, path)
+		b, inAfter := lookupPath(after, path)
+		if !sameValue(a, inBefore, b, inAfter) {
+			changed = append(changed, joinPath(path))
+		}
+	}
+	walkLeaves(before, nil, check)
+	walkLeaves(after, nil, check)
+
+	if len(changed) == 0 {
+		return "", false
+	}
+	sort.Strings(changed)
+	return changed[0], true
+}
@@ -0,0 +1,113 @@
+package koanfuri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeLockedKeys(t *testing.T) {
+	const base = `
+__LOCKED__:
+  - security.tls.min_version
+  - "security.headers.**"
+security:
+  tls:
+    min_version: "1.2"
+    ciphers: [aes]
+  headers:
+    hsts: true
+server:
+  port: 8080
+`
+	tests := []struct {
+		name   string
+		patch  string
+		locked []string
+		err    string
+	}{
+		{
+			name:  "unlocked keys can change",
+			patch: "security:\n  tls:\n    ciphers: [chacha]\n    min_version: \"1.2\"\nserver:\n  port: 9090\n",
+		},
+		{
+			name:  "changing a locked key",
+			patch: "security:\n  tls:\n    min_version: \"1.0\"\n",
+			err:   `file:///patch.yaml may not change locked key "security.tls.min_version"`,
+		},
+		{
+			name:  "deleting a locked key",
+			patch: "security:\n  tls:\n    min_version: __TOMBSTONE__\n",
+			err:   `may not change locked key "security.tls.min_version"`,
+		},
+		{
+			name:  "adding below a locked key",
+			patch: "security:\n  headers:\n    csp: none\n",
+			err:   `may not change locked key "security.headers.csp"`,
+		},
+		{
+			name:  "replacing a parent of a locked key",
+			patch: "security: disabled\n",
+			err:   `may not change locked key "security.headers.hsts"`,
+		},
+		{
+			name:  "JSON Patch",
+			patch: `[{"op": "remove", "path": "/security/tls"}]`,
+			err:   `may not change locked key "security.tls.min_version"`,
+		},
+		{
+			name:   "keys locked by the merge options",
+			patch:  "server:\n  port: 9090\n",
+			locked: []string{"server.*"},
+			err:    `may not change locked key "server.port"`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			require.False(t, k.konfig.Exists(directiveLocked))
+			before := k.konfig.Raw()
+
+			err := k.Merge(newTestKoanfURI(t, "patch.yaml", tc.patch), MergeOptions{Strategy: "overwrite", Locked: tc.locked})
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tc.err)
+			require.Equal(t, before, k.konfig.Raw())
+			require.Equal(t, "file:///base.yaml", origins(k)["security.tls.min_version"])
+		})
+	}
+}
+
+func TestMergeLocksFromPatches(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "server:\n  port: 8080\n")
+	require.NoError(t, k.Merge(newTestKoanfURI(t, "platform.yaml", "__LOCKED__: [server.port]\nserver:\n  port: 443\n"), MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, 443, k.konfig.Get("server.port"))
+
+	err := k.Merge(newTestKoanfURI(t, "team.yaml", "server:\n  port: 80\n"), MergeOptions{Strategy: "overwrite"})
+	require.ErrorContains(t, err, `file:///team.yaml may not change locked key "server.port"`)
+}
+
+func TestLoadLockedKeys(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	policyFile := filepath.Join(tmpDir, "policy.yaml")
+	require.NoError(t, os.WriteFile(policyFile, []byte("locked:\n  - security.tls.min_version\n  - \"**.password\"\n"), 0644))
+	locked, err := LoadLockedKeys(policyFile)
+	require.NoError(t, err)
+	require.Equal(t, []string{"security.tls.min_version", "**.password"}, locked)
+
+	badFile := filepath.Join(tmpDir, "bad.yaml")
+	require.NoError(t, os.WriteFile(badFile, []byte("locked: security\n"), 0644))
+	_, err = LoadLockedKeys(badFile)
+	require.Error(t, err)
+
+	lockedDocument := filepath.Join(tmpDir, "base.yaml")
+	require.NoError(t, os.WriteFile(lockedDocument, []byte("__LOCKED__: [1]\n"), 0644))
+	_, err = NewKoanfURI(lockedDocument)
+	require.ErrorContains(t, err, "invalid __LOCKED__")
+}
@@ -2,16 +2,54 @@ package koanfuri
 
 import (
 	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
 
-	"github.com/knadh/koanf/maps"
 	"github.com/knadh/koanf/providers/confmap"
 	"github.com/knadh/koanf/v2"
 )
 
+// MergeOptions controls how another KoanfURI is layered over the current configuration.
+type MergeOptions struct {
+	// Strategy selects how lists are merged (preserve, overwrite, keyed, union, index). The merge-patch strategy follows RFC 7386
+	// JSON Merge Patch: lists are replaced and a null value deletes the key, unless NullMode says otherwise.
+	Strategy string
+	// MergeKey is the field used to match list items that are maps when Strategy is keyed.
+	MergeKey string
+	// Rules override Strategy and MergeKey for lists at matching key paths. The first matching rule wins.
+	Rules []MergeRule
+	// TombstoneMarker is the value that deletes a key, "__TOMBSTONE__" when empty.
+	TombstoneMarker string
+	// OnTypeConflict decides what happens when a patch changes the type of a value, e.g. replaces a map with a string:
+	// "replace" (the default when empty) lets the patch win, "warn" logs the conflict first and "error" fails the merge.
+	OnTypeConflict string
+	// NullMode decides what a null value in a patch does: "set" stores the null, "delete" deletes the key and "ignore"
+	// leaves the existing value alone. When empty, the merge-patch strategy deletes and every other strategy sets. Rules
+	// can pick another mode for the keys they match. Nulls inside lists are always kept.
+	NullMode string
+	// KeyMatch decides how keys of a patch find the keys they merge into: "exact" (the default when empty) requires the
+	// same spelling, "insensitive" ignores case and "normalized" also ignores "_" and "-", so max_conns, max-conns and
+	// maxConns are the same key. Matched keys keep the spelling of the configuration being merged into. A patch map holding
+	// two keys that match each other fails the merge.
+	KeyMatch string
+	// EmptyClears makes an empty map or list in a patch clear the value it is merged into, whatever the strategy.
+	// Otherwise an empty map merges nothing and an empty list follows the list strategy.
+	EmptyClears bool
+	// Locked lists key paths the patch may not change, on top of those locked by the documents merged so far (see
+	// locks.go). Paths use the same patterns as MergeRule.
+	Locked []string
+	// Vars holds the variables that the condition of a patch can read as vars.name (see conditions.go).
+	Vars map[string]string
+}
+
 // Merge combines the configuration from another KoanfURI instance into this one.
 // The configuration from the other instance will be merged on top of the current configuration.
-// Returns an error if either KoanfURI instance is nil or if the merge operation fails.
-func (k *KoanfURI) Merge(other *KoanfURI, mergeStrategy string) error {
+// A patch whose condition is false is skipped.
+// Returns an error if either KoanfURI instance is nil, if an assertion of the other instance doesn't hold or if the merge
+// operation fails. A merge that changes a locked key fails and leaves the configuration as it was.
+func (k *KoanfURI) Merge(other *KoanfURI, opts MergeOptions) error {
 	// Check for nil instances
 	if k == nil {
 		return fmt.Errorf("cannot merge into nil KoanfURI")
@@ -28,69 +66,533 @@ func (k *KoanfURI) Merge(other *KoanfURI, mergeStrategy string) error {
 		return fmt.Errorf("source KoanfURI has nil konfig")
 	}
 
-	if mergeStrategy == "preserve" {
-		k.konfig.Load(confmap.Provider(other.konfig.Raw(), "."), nil, koanf.WithMergeFunc(customKoanfMergeFuncPreserveSlice))
-	} else if mergeStrategy == "overwrite" {
-		k.konfig.Load(confmap.Provider(other.konfig.Raw(), "."), nil, koanf.WithMergeFunc(customKoanfMergeFuncNoPreserveSlice))
-	} else {
-		return fmt.Errorf("invalid merge strategy: %s", mergeStrategy)
+	applies, err := k.applies(other, opts.Vars)
+	if err != nil {
+		return err
+	}
+	if !applies {
+		slog.Info("skipping patch, its condition is false", "patch", other.String(), "when", other.when)
+		return nil
+	}
+
+	if err := k.checkAssertions(other); err != nil {
+		return err
+	}
+
+	// Keep a copy of the configuration to restore if the patch changes a locked key
+	locked := slices.Concat(k.locked, opts.Locked)
+	var before map[string]interface{}
+	var provenance *provenanceTree
+	if len(locked) > 0 {
+		before = k.konfig.Raw()
+		provenance = k.provenance.clone()
+	}
+
+	if err := k.merge(other, opts); err != nil {
+		return err
+	}
+
+	if len(locked) > 0 {
+		if path, changed := lockedChange(locked, before, k.konfig.Raw()); changed {
+			if err := k.reload(before); err != nil {
+				return fmt.Errorf("failed to restore configuration: %w", err)
+			}
+			k.provenance = provenance
+			return fmt.Errorf("%s may not change locked key %q", other, path)
+		}
+	}
+	k.locked = slices.Concat(k.locked, other.locked)
+
+	return nil
+}
+
+// merge merges other into the configuration, without checking locked keys.
+func (k *KoanfURI) merge(other *KoanfURI, opts MergeOptions) error {
+	// JSON Patch documents carry operations instead of configuration
+	if other.IsJSONPatch() {
+		return k.applyJSONPatch(other)
+	}
+	if err := validateStrategy(opts.Strategy, opts.MergeKey); err != nil {
+		return err
+	}
+	for _, rule := range opts.Rules {
+		if err := rule.validate(opts.MergeKey); err != nil {
+			return err
+		}
+	}
+	switch opts.OnTypeConflict {
+	case "", "replace", "warn", "error":
+	default:
+		return fmt.Errorf("invalid type conflict policy: %s", opts.OnTypeConflict)
+	}
+	if err := validateNullMode(opts.NullMode); err != nil {
+		return err
+	}
+	switch opts.KeyMatch {
+	case "", "exact", "insensitive", "normalized":
+	default:
+		return fmt.Errorf("invalid key match mode: %s", opts.KeyMatch)
+	}
+	if other.overrides != nil {
+		return k.applyOverrides(other, opts)
+	}
+
+	// The patch is already nested, so it is loaded without a delimiter to keep keys containing dots intact
+	m := &merger{opts: opts, dest: k, src: other}
+	if err := k.konfig.Load(confmap.Provider(other.konfig.Raw(), ""), nil, koanf.WithMergeFunc(m.mergeFunc)); err != nil {
+		return fmt.Errorf("failed to merge configuration: %w", err)
 	}
+	k.trackChanges(other, m.changes)
 
 	return nil
 }
 
-func customKoanfMergeFuncPreserveSlice(src, dest map[string]interface{}) error {
-	// First pass: look for and handle "__TOMBSTONE__" values
-	for k, v := range src {
-		if str, ok := v.(string); ok && str == "__TOMBSTONE__" {
-			delete(src, k)  // Remove from source
-			delete(dest, k) // Remove from destination
+// validateStrategy checks that strategy is a known list merge strategy and that it has everything it needs to run.
+func validateStrategy(strategy string, mergeKey string) error {
+	switch strategy {
+	case "preserve", "overwrite", "merge-patch", "union", "index":
+		return nil
+	case "keyed":
+		if mergeKey == "" {
+			return fmt.Errorf("keyed merge strategy requires a merge key")
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid merge strategy: %s", strategy)
+	}
+}
+
+// isEmpty reports whether v is a map or a list without any items.
+func isEmpty(v interface{}) bool {
+	list, ok := v.([]interface{})
+	return isEmptyMap(v) || (ok && len(list) == 0)
+}
+
+// validateNullMode checks that mode is a known null mode, or empty.
+func validateNullMode(mode string) error {
+	switch mode {
+	case "", "set", "delete", "ignore":
+		return nil
+	default:
+		return fmt.Errorf("invalid null mode: %s", mode)
+	}
+}
+
+// merger holds the options for a single Merge call. It walks the patch and the destination together so that
+// the key path of every value is known, which is what lets rules pick a list strategy per path. Every change is
+// recorded so that provenance can be updated once the merge is done.
+type merger struct {
+	opts    MergeOptions
+	dest    *KoanfURI
+	src     *KoanfURI
+	changes []provenanceChange
+}
+
+// record notes that the value at path was set by the patch, or removed by it.
+func (m *merger) record(path []string, removed bool) {
+	m.changes = append(m.changes, provenanceChange{path: path, removed: removed})
+}
+
+// mergeFunc adapts the merger to koanf.WithMergeFunc.
+func (m *merger) mergeFunc(src, dest map[string]interface{}) error {
+	if err := m.applyTransfers(src, dest); err != nil {
+		return err
+	}
+	return m.mergeMaps(src, dest, nil)
+}
+
+// mergeMaps merges src into dest. Keys set to the tombstone marker are deleted from dest, nulls follow the null mode for
+// their path, maps are merged recursively, lists present on both sides are merged with the list strategy for their
+// path and everything else in src replaces the value in dest. Merge directives in src are applied and stripped (see
+// directives.go).
+func (m *merger) mergeMaps(src, dest map[string]interface{}, path []string) error {
+	directive, err := mapDirective(src, path)
+	if err != nil {
+		return err
+	}
+	if directive == "replace" {
+		clear(dest)
+		m.record(path, true)
+	}
+
+	if err := m.checkKeyCollisions(src, path); err != nil {
+		return err
+	}
+
+	for srcKey, v := range src {
+		if isDirectiveKey(srcKey) {
+			continue
+		}
+		k := m.destKey(dest, srcKey)
+		keyPath := childPath(path, k)
+
+		if m.isTombstone(v) {
+			delete(dest, k)
+			m.record(keyPath, true)
 			continue
 		}
 
-		// Handle nested maps
-		if srcMap, ok := v.(map[string]interface{}); ok {
-			if destMap, exists := dest[k].(map[string]interface{}); exists {
-				customKoanfMergeFuncPreserveSlice(srcMap, destMap)
+		if v == nil {
+			switch m.nullMode(keyPath) {
+			case "delete":
+				delete(dest, k)
+				m.record(keyPath, true)
+				continue
+			case "ignore":
 				continue
 			}
 		}
 
-		if srcSlice, ok := v.([]interface{}); ok {
-			if destSlice, exists := dest[k].([]interface{}); exists {
-				mergedSlice := make([]interface{}, len(destSlice))
-				copy(mergedSlice, destSlice)
-				mergedSlice = append(mergedSlice, srcSlice...)
-				src[k] = mergedSlice
+		// Moves and copies were applied before the merge, see transfer.go
+		if isTransferOnly(v) {
+			continue
+		}
+
+		if existing, ok := dest[k]; ok {
+			if err := m.checkTypeConflict(keyPath, existing, patchValue(v)); err != nil {
+				return err
+			}
+		}
+
+		if m.opts.EmptyClears && isEmpty(v) {
+			dest[k] = m.prepare(v)
+			m.record(keyPath, false)
+			continue
+		}
+
+		if isWrapper(v) {
+			mergedValue, err := m.mergeWrapper(v.(map[string]interface{}), dest[k], keyPath)
+			if err != nil {
+				return err
+			}
+			dest[k] = mergedValue
+			m.record(keyPath, false)
+			continue
+		}
+
+		switch srcVal := v.(type) {
+		case map[string]interface{}:
+			// Maps are always merged, into an empty map if there is nothing to merge with, so that tombstones, nulls
+			// and directives are handled the same way at every depth
+			destMap, ok := dest[k].(map[string]interface{})
+			if !ok {
+				destMap = make(map[string]interface{})
+			}
+			if err := m.mergeMaps(srcVal, destMap, keyPath); err != nil {
+				return err
+			}
+			dest[k] = destMap
+			if !ok {
+				m.record(keyPath, false)
+			}
+			continue
+		case []interface{}:
+			if destSlice, ok := dest[k].([]interface{}); ok {
+				mergedSlice, err := m.mergeSlices(srcVal, destSlice, keyPath)
+				if err != nil {
+					return err
+				}
+				dest[k] = mergedSlice
+				m.record(keyPath, false)
+				continue
 			}
 		}
+
+		dest[k] = m.prepare(v)
+		m.record(keyPath, false)
 	}
-	// Perform regular merge for remaining values
-	maps.Merge(src, dest)
 	return nil
 }
 
-// customKoanfMergeFuncNoPreserveSlice is a custom merge function that handles "__TOMBSTONE__" values and deletes the key if set to
-// "__TOMBSTONE__". it calls itself recursively. Otherwise, uses default maps.merge behavior with slices (replace slice wholesale)
-func customKoanfMergeFuncNoPreserveSlice(src, dest map[string]interface{}) error {
-	// First pass: look for and handle "__TOMBSTONE__" values
-	for k, v := range src {
-		if str, ok := v.(string); ok && str == "__TOMBSTONE__" {
-			delete(src, k)  // Remove from source
-			delete(dest, k) // Remove from destination
+// destKey returns the key of dest that the patch key k merges into: k itself, or the existing key of dest matching it
+// under the key match mode. Keys new to dest keep the spelling of the patch.
+func (m *merger) destKey(dest map[string]interface{}, k string) string {
+	if _, ok := dest[k]; ok {
+		return k
+	}
+	if m.opts.KeyMatch == "" || m.opts.KeyMatch == "exact" {
+		return k
+	}
+
+	// Sort the candidates so the same key wins every time if dest already spells a key in several ways
+	normalized := normalizeKey(m.opts.KeyMatch, k)
+	var matches []string
+	for existing := range dest {
+		if normalizeKey(m.opts.KeyMatch, existing) == normalized {
+			matches = append(matches, existing)
+		}
+	}
+	if len(matches) == 0 {
+		return k
+	}
+	slices.Sort(matches)
+	return matches[0]
+}
+
+// checkKeyCollisions fails when two keys of src match each other under the key match mode, e.g. maxConns and max-conns
+// in normalized mode. Either could win, so the patch is ambiguous.
+func (m *merger) checkKeyCollisions(src map[string]interface{}, path []string) error {
+	if m.opts.KeyMatch == "" || m.opts.KeyMatch == "exact" {
+		return nil
+	}
+
+	keys := slices.Sorted(maps.Keys(src))
+	seen := make(map[string]string, len(keys))
+	for _, key := range keys {
+		if isDirectiveKey(key) {
 			continue
 		}
+		normalized := normalizeKey(m.opts.KeyMatch, key)
+		if other, ok := seen[normalized]; ok {
+			return fmt.Errorf("patch keys %q and %q are the same key with %s key matching",
+				joinPath(childPath(path, other)), joinPath(childPath(path, key)), m.opts.KeyMatch)
+		}
+		seen[normalized] = key
+	}
+	return nil
+}
 
-		// Handle nested maps
-		if srcMap, ok := v.(map[string]interface{}); ok {
-			if destMap, exists := dest[k].(map[string]interface{}); exists {
-				customKoanfMergeFuncNoPreserveSlice(srcMap, destMap)
-				continue
+// normalizeKey returns the form of key that is compared under the key match mode.
+func normalizeKey(mode string, key string) string {
+	switch mode {
+	case "insensitive":
+		return strings.ToLower(key)
+	case "normalized":
+		return strings.ToLower(strings.NewReplacer("_", "", "-", "").Replace(key))
+	default:
+		return key
+	}
+}
+
+// mergeWrapper merges the value held by a directive wrapper into dest and returns the result.
+func (m *merger) mergeWrapper(wrapper map[string]interface{}, dest interface{}, path []string) (interface{}, error) {
+	if isPositional(wrapper) {
+		return m.mergePositional(wrapper, dest, path)
+	}
+
+	switch srcVal := wrapper[directiveValue].(type) {
+	case []interface{}:
+		strategy, mergeKey, err := listDirective(wrapper, path)
+		if err != nil {
+			return nil, err
+		}
+		destSlice, ok := dest.([]interface{})
+		if !ok {
+			return m.prepare(srcVal), nil
+		}
+
+		defaultStrategy, defaultKey := m.listStrategy(path)
+		if strategy == "" {
+			strategy = defaultStrategy
+		}
+		if mergeKey == "" {
+			mergeKey = defaultKey
+		}
+		if err := validateStrategy(strategy, mergeKey); err != nil {
+			return nil, fmt.Errorf("merge directive at %q: %w", joinPath(path), err)
+		}
+		return m.mergeSlicesWith(strategy, mergeKey, srcVal, destSlice, path)
+	case map[string]interface{}:
+		directive, err := mapDirective(wrapper, path)
+		if err != nil {
+			return nil, err
+		}
+		destMap, ok := dest.(map[string]interface{})
+		if !ok || directive == "replace" {
+			destMap = make(map[string]interface{})
+		}
+		if err := m.mergeMaps(srcVal, destMap, path); err != nil {
+			return nil, err
+		}
+		return destMap, nil
+	default:
+		return m.prepare(srcVal), nil
+	}
+}
+
+// mergeSlices merges the src list into the dest list using the list strategy that applies to path.
+func (m *merger) mergeSlices(src, dest []interface{}, path []string) ([]interface{}, error) {
+	strategy, mergeKey := m.listStrategy(path)
+	return m.mergeSlicesWith(strategy, mergeKey, src, dest, path)
+}
+
+// mergeSlicesWith merges the src list into the dest list using the given strategy. List tombstones in src remove the
+// items they match from dest first, and a src list made only of list tombstones does nothing else, whatever the strategy.
+func (m *merger) mergeSlicesWith(strategy string, mergeKey string, src, dest []interface{}, path []string) ([]interface{}, error) {
+	remaining, kept := m.removeListItems(src, dest, mergeKey)
+	if len(src) > 0 && len(remaining) == 0 {
+		return kept, nil
+	}
+	src, dest = remaining, kept
+
+	switch strategy {
+	case "preserve":
+		mergedSlice := make([]interface{}, len(dest), len(dest)+len(src))
+		copy(mergedSlice, dest)
+		return append(mergedSlice, m.prepare(src).([]interface{})...), nil
+	case "union":
+		mergedSlice := make([]interface{}, 0, len(dest)+len(src))
+		for _, item := range slices.Concat(dest, m.prepare(src).([]interface{})) {
+			if !slices.ContainsFunc(mergedSlice, func(v interface{}) bool { return valuesEqual(v, item) }) {
+				mergedSlice = append(mergedSlice, item)
 			}
 		}
+		return mergedSlice, nil
+	case "keyed":
+		return m.mergeKeyedSlice(src, dest, mergeKey, path)
+	case "index":
+		return m.mergeIndexedSlice(src, dest, path)
+	default:
+		return m.prepare(src).([]interface{}), nil
+	}
+}
+
+// checkTypeConflict applies the type conflict policy when a patch replaces existing with a value of another type.
+// Nulls never conflict.
+func (m *merger) checkTypeConflict(path []string, existing, incoming interface{}) error {
+	if existing == nil || incoming == nil {
+		return nil
+	}
+	existingType, incomingType := typeName(existing), typeName(incoming)
+	if existingType == incomingType {
+		return nil
+	}
 
+	switch m.opts.OnTypeConflict {
+	case "error":
+		return fmt.Errorf("type conflict at %q: %s from %s would be replaced by %s from %s",
+			joinPath(path), existingType, m.dest.originOf(path).URI, incomingType, m.src.originOf(path).URI)
+	case "warn":
+		slog.Warn("type conflict while merging", "path", joinPath(path),
+			"type", existingType, "source", m.dest.originOf(path).URI, "new_type", incomingType, "patch", m.src.originOf(path).URI)
 	}
-	// Perform regular merge for remaining values
-	maps.Merge(src, dest)
 	return nil
 }
+
+// nullMode returns what a null value at path does, taken from the first matching rule with a null mode or from the
+// global options. RFC 7386 JSON Merge Patch deletes keys set to null, so that is the default for merge-patch.
+func (m *merger) nullMode(path []string) string {
+	for _, rule := range m.opts.Rules {
+		if rule.Null != "" && matchPath(rule.Path, path) {
+			return rule.Null
+		}
+	}
+	switch {
+	case m.opts.NullMode != "":
+		return m.opts.NullMode
+	case m.opts.Strategy == "merge-patch":
+		return "delete"
+	default:
+		return "set"
+	}
+}
+
+// listStrategy returns the strategy and merge key for the list at path, taken from the first matching rule with a
+// strategy or from the global options when no rule matches.
+func (m *merger) listStrategy(path []string) (string, string) {
+	for _, rule := range m.opts.Rules {
+		if rule.Strategy != "" && matchPath(rule.Path, path) {
+			if rule.MergeKey != "" {
+				return rule.Strategy, rule.MergeKey
+			}
+			return rule.Strategy, m.opts.MergeKey
+		}
+	}
+	return m.opts.Strategy, m.opts.MergeKey
+}
+
+// mergeKeyedSlice merges src into a copy of dest. Items of src that are maps with a mergeKey value matching an item already
+// in the list are merged into that item, everything else is appended. Fields of list items share the path of the list.
+func (m *merger) mergeKeyedSlice(src, dest []interface{}, mergeKey string, path []string) ([]interface{}, error) {
+	mergedSlice := make([]interface{}, len(dest))
+	copy(mergedSlice, dest)
+
+	for _, item := range src {
+		srcItem, ok := item.(map[string]interface{})
+		if !ok {
+			mergedSlice = append(mergedSlice, m.prepare(item))
+			continue
+		}
+
+		idx := findKeyedItem(mergedSlice, mergeKey, srcItem[mergeKey])
+		if idx < 0 {
+			mergedSlice = append(mergedSlice, m.prepare(item))
+			continue
+		}
+
+		destItem := mergedSlice[idx].(map[string]interface{})
+		if err := m.mergeMaps(srcItem, destItem, path); err != nil {
+			return nil, err
+		}
+		mergedSlice[idx] = destItem
+	}
+
+	return mergedSlice, nil
+}
+
+// mergeIndexedSlice merges each item of src into the item of dest at the same index and appends the items of src past
+// the end of dest. Maps are merged recursively, lists with the list strategy for path, directive wrappers are applied
+// and anything else is replaced. Items of the list share the path of the list.
+func (m *merger) mergeIndexedSlice(src, dest []interface{}, path []string) ([]interface{}, error) {
+	mergedSlice := make([]interface{}, len(dest))
+	copy(mergedSlice, dest)
+
+	for i, item := range src {
+		if i >= len(mergedSlice) {
+			mergedSlice = append(mergedSlice, m.prepare(item))
+			continue
+		}
+		if err := m.checkTypeConflict(path, mergedSlice[i], patchValue(item)); err != nil {
+			return nil, err
+		}
+
+		if isWrapper(item) {
+			mergedItem, err := m.mergeWrapper(item.(map[string]interface{}), mergedSlice[i], path)
+			if err != nil {
+				return nil, err
+			}
+			mergedSlice[i] = mergedItem
+			continue
+		}
+
+		switch srcItem := item.(type) {
+		case map[string]interface{}:
+			if destItem, ok := mergedSlice[i].(map[string]interface{}); ok {
+				if err := m.mergeMaps(srcItem, destItem, path); err != nil {
+					return nil, err
+				}
+				continue
+			}
+		case []interface{}:
+			if destItem, ok := mergedSlice[i].([]interface{}); ok {
+				mergedItem, err := m.mergeSlices(srcItem, destItem, path)
+				if err != nil {
+					return nil, err
+				}
+				mergedSlice[i] = mergedItem
+				continue
+			}
+		}
+		mergedSlice[i] = m.prepare(item)
+	}
+
+	return mergedSlice, nil
+}
+
+// findKeyedItem returns the index of the first map in list whose mergeKey field matches value, or -1 if there is none.
+// Values are compared by their string form so that numeric ids match regardless of which parser produced them.
+func findKeyedItem(list []interface{}, mergeKey string, value interface{}) int {
+	if value == nil {
+		return -1
+	}
+	for i, item := range list {
+		itemMap, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if v, exists := itemMap[mergeKey]; exists && v != nil && fmt.Sprint(v) == fmt.Sprint(value) {
+			return i
+		}
+	}
+	return -1
+}
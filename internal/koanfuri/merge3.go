@@ -0,0 +1,102 @@
+package koanfuri
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Conflict is a key path that two edits of the same configuration changed in different ways. Base, Ours and Theirs hold
+// the value on each side, nil when the key doesn't exist there.
+type Conflict struct {
+	Path   string      `json:"path"`
+	Base   interface{} `json:"base"`
+	Ours   interface{} `json:"ours"`
+	Theirs interface{} `json:"theirs"`
+}
+
+// Merge3 merges theirs into this configuration, where both are edits of base. A key changed on only one side takes the
+// changed value and maps changed on both sides are merged key by key. Anything else changed on both sides in different
+// ways is a conflict: it keeps this configuration's value and is returned, sorted by path. Lists are compared as a whole.
+// The __LOCKED__ lists of the documents are merged like any other list and kept in the merged configuration, where
+// they are written out again instead of being enforced.
+func (k *KoanfURI) Merge3(base, theirs *KoanfURI) ([]Conflict, error) {
+	if k == nil || base == nil || theirs == nil {
+		return nil, fmt.Errorf("cannot merge nil KoanfURI")
+	}
+	for _, input := range []*KoanfURI{k, base, theirs} {
+		if input.IsJSONPatch() {
+			return nil, fmt.Errorf("%s is a JSON Patch document, three-way merges need configuration documents", input)
+		}
+		if directives := input.PatchDirectives(); len(directives) > 0 {
+			return nil, fmt.Errorf("%s cannot be used in %s, only in patches", strings.Join(directives, " and "), input)
+		}
+	}
+
+	m := &merger3{}
+	merged, _ := m.mergeValues(base.rawWithLocks(), true, k.rawWithLocks(), true, theirs.rawWithLocks(), true, nil)
+	if err := k.reload(merged.(map[string]interface{})); err != nil {
+		return nil, fmt.Errorf("failed to load merged configuration: %w", err)
+	}
+	k.locked = nil
+	k.trackChanges(theirs, m.changes)
+
+	sort.Slice(m.conflicts, func(i, j int) bool {
+		return m.conflicts[i].Path < m.conflicts[j].Path
+	})
+	return m.conflicts, nil
+}
+
+// merger3 collects the conflicts of a three-way merge and the changes taken from theirs.
+type merger3 struct {
+	conflicts []Conflict
+	changes   []provenanceChange
+}
+
+// mergeValues merges the values found at path on each side, each with a flag telling whether the key exists there. It
+// returns the merged value and whether the key exists in the result.
+func (m *merger3) mergeValues(base interface{}, inBase bool, ours interface{}, inOurs bool, theirs interface{}, inTheirs bool, path []string) (interface{}, bool) {
+	switch {
+	case sameValue(ours, inOurs, theirs, inTheirs), sameValue(base, inBase, theirs, inTheirs):
+		return ours, inOurs
+	case sameValue(base, inBase, ours, inOurs):
+		m.changes = append(m.changes, provenanceChange{path: path, removed: !inTheirs})
+		return theirs, inTheirs
+	}
+
+	ourMap, ourOK := ours.(map[string]interface{})
+	theirMap, theirOK := theirs.(map[string]interface{})
+	if ourOK && theirOK {
+		// A base that isn't a map means both sides added the map, so every key is new
+		baseMap, _ := base.(map[string]interface{})
+
+		keys := make(map[string]bool)
+		for _, side := range []map[string]interface{}{baseMap, ourMap, theirMap} {
+			for key := range side {
+				keys[key] = true
+			}
+		}
+
+		merged := make(map[string]interface{}, len(keys))
+		for key := range keys {
+			b, bOK := baseMap[key]
+			o, oOK := ourMap[key]
+			t, tOK := theirMap[key]
+			if v, ok := m.mergeValues(b, bOK, o, oOK, t, tOK, childPath(path, key)); ok {
+				merged[key] = v
+			}
+		}
+		return merged, true
+	}
+
+	m.conflicts = append(m.conflicts, Conflict{Path: joinPath(path), Base: base, Ours: ours, Theirs: theirs})
+	return ours, inOurs
+}
+
+// sameValue reports whether two sides agree on a key: both lack it or both hold equal values.
+func sameValue(a interface{}, inA bool, b interface{}, inB bool) bool {
+	if !inA || !inB {
+		return inA == inB
+	}
+	return valuesEqual(a, b)
+}
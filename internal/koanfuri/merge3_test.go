@@ -0,0 +1,163 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge3(t *testing.T) {
+	const base = `
+server:
+  host: localhost
+  port: 8080
+  plugins: [auth]
+database:
+  name: myapp
+  user: app
+features:
+  beta: false
+`
+	tests := []struct {
+		name      string
+		ours      string
+		theirs    string
+		expected  map[string]interface{}
+		conflicts []Conflict
+	}{
+		{
+			name:   "changes on different keys are combined",
+			ours:   "server:\n  host: localhost\n  port: 9090\n  plugins: [auth]\ndatabase:\n  name: myapp\n  user: app\nfeatures:\n  beta: false\n",
+			theirs: "server:\n  host: example.com\n  port: 8080\n  plugins: [auth]\ndatabase:\n  name: myapp\nfeatures:\n  beta: false\n  gamma: true\n",
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"host": "example.com", "port": 9090, "plugins": []interface{}{"auth"}},
+				"database": map[string]interface{}{"name": "myapp"},
+				"features": map[string]interface{}{"beta": false, "gamma": true},
+			},
+		},
+		{
+			name:   "identical changes don't conflict",
+			ours:   `{"server": {"host": "localhost", "port": 9090, "plugins": ["auth"]}, "database": {"name": "myapp", "user": "app"}, "features": {"beta": true}}`,
+			theirs: "server:\n  host: localhost\n  port: 9090\n  plugins: [auth]\ndatabase:\n  name: myapp\n  user: app\nfeatures:\n  beta: true\n",
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"host": "localhost", "port": 9090, "plugins": []interface{}{"auth"}},
+				"database": map[string]interface{}{"name": "myapp", "user": "app"},
+				"features": map[string]interface{}{"beta": true},
+			},
+		},
+		{
+			name:   "conflicting changes keep ours",
+			ours:   "server:\n  host: localhost\n  port: 9090\n  plugins: [auth, cache]\ndatabase:\n  name: myapp\n  user: app\nfeatures:\n  beta: false\n",
+			theirs: "server:\n  host: localhost\n  port: 7070\n  plugins: [auth, logger]\ndatabase:\n  name: myapp\nfeatures: disabled\n",
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"host": "localhost", "port": 9090, "plugins": []interface{}{"auth", "cache"}},
+				"database": map[string]interface{}{"name": "myapp"},
+				"features": "disabled",
+			},
+			conflicts: []Conflict{
+				{Path: "server.plugins", Base: []interface{}{"auth"}, Ours: []interface{}{"auth", "cache"}, Theirs: []interface{}{"auth", "logger"}},
+				{Path: "server.port", Base: 8080, Ours: 9090, Theirs: 7070},
+			},
+		},
+		{
+			name:   "change against deletion conflicts",
+			ours:   "server:\n  host: localhost\n  port: 8080\n  plugins: [auth]\ndatabase:\n  name: myapp\n  user: admin\nfeatures:\n  beta: false\n",
+			theirs: "server:\n  host: localhost\n  port: 8080\n  plugins: [auth]\nfeatures:\n  beta: false\n",
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"host": "localhost", "port": 8080, "plugins": []interface{}{"auth"}},
+				"database": map[string]interface{}{"name": "myapp", "user": "admin"},
+				"features": map[string]interface{}{"beta": false},
+			},
+			conflicts: []Conflict{
+				{Path: "database", Base: map[string]interface{}{"name": "myapp", "user": "app"}, Ours: map[string]interface{}{"name": "myapp", "user": "admin"}},
+			},
+		},
+		{
+			name:   "keys added on both sides are merged",
+			ours:   "server:\n  host: localhost\n  port: 8080\n  plugins: [auth]\ndatabase:\n  name: myapp\n  user: app\nfeatures:\n  beta: false\ncache:\n  size: 10\n",
+			theirs: "server:\n  host: localhost\n  port: 8080\n  plugins: [auth]\ndatabase:\n  name: myapp\n  user: app\nfeatures:\n  beta: false\ncache:\n  ttl: 60\n",
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"host": "localhost", "port": 8080, "plugins": []interface{}{"auth"}},
+				"database": map[string]interface{}{"name": "myapp", "user": "app"},
+				"features": map[string]interface{}{"beta": false},
+				"cache":    map[string]interface{}{"size": 10, "ttl": 60},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ours := newTestKoanfURI(t, "ours.yaml", tc.ours)
+			conflicts, err := ours.Merge3(newTestKoanfURI(t, "base.yaml", base), newTestKoanfURI(t, "theirs.yaml", tc.theirs))
+			require.NoError(t, err)
+			require.Equal(t, tc.conflicts, conflicts)
+			require.Equal(t, tc.expected, ours.konfig.Raw())
+		})
+	}
+}
+
+func TestMerge3Provenance(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", "server:\n  host: localhost\n  port: 8080\n")
+	ours := newTestKoanfURI(t, "ours.yaml", "server:\n  host: localhost\n  port: 9090\n")
+	theirs := newTestKoanfURI(t, "theirs.yaml", "server:\n  host: example.com\n  port: 8080\n")
+
+	conflicts, err := ours.Merge3(base, theirs)
+	require.NoError(t, err)
+	require.Empty(t, conflicts)
+	require.Equal(t, map[string]string{
+		"server.host": "file:///theirs.yaml",
+		"server.port": "file:///ours.yaml",
+	}, origins(ours))
+}
+
+func TestMerge3PatchDirectives(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", "__ASSERT__:\n  - path: server\nserver:\n  port: 8080\n")
+	ours := newTestKoanfURI(t, "ours.yaml", "server:\n  port: 9090\n")
+	theirs := newTestKoanfURI(t, "theirs.yaml", "server:\n  port: 8080\n")
+
+	_, err := ours.Merge3(base, theirs)
+	require.ErrorContains(t, err, "__ASSERT__ cannot be used in file:///base.yaml, only in patches")
+}
+
+func TestMerge3LockedKeys(t *testing.T) {
+	const base = "__LOCKED__: [a]\na: 1\nb: 2\n"
+
+	t.Run("lock list changed on one side", func(t *testing.T) {
+		ours := newTestKoanfURI(t, "ours.yaml", "__LOCKED__: [a]\na: 1\nb: 3\n")
+		theirs := newTestKoanfURI(t, "theirs.yaml", "__LOCKED__: [a, b]\na: 1\nb: 2\n")
+
+		conflicts, err := ours.Merge3(newTestKoanfURI(t, "base.yaml", base), theirs)
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+		require.Equal(t, map[string]interface{}{
+			"__LOCKED__": []interface{}{"a", "b"},
+			"a":          1,
+			"b":          3,
+		}, ours.konfig.Raw())
+	})
+
+	t.Run("lock list changed on both sides", func(t *testing.T) {
+		ours := newTestKoanfURI(t, "ours.yaml", "__LOCKED__: [a, c]\na: 1\nb: 2\n")
+		theirs := newTestKoanfURI(t, "theirs.yaml", "__LOCKED__: [a, b]\na: 1\nb: 2\n")
+
+		conflicts, err := ours.Merge3(newTestKoanfURI(t, "base.yaml", base), theirs)
+		require.NoError(t, err)
+		require.Equal(t, []Conflict{{
+			Path:   "__LOCKED__",
+			Base:   []interface{}{"a"},
+			Ours:   []interface{}{"a", "c"},
+			Theirs: []interface{}{"a", "b"},
+		}}, conflicts)
+		require.Equal(t, []interface{}{"a", "c"}, ours.konfig.Get("__LOCKED__"))
+	})
+
+	t.Run("lock list removed on one side", func(t *testing.T) {
+		ours := newTestKoanfURI(t, "ours.yaml", "__LOCKED__: [a]\na: 1\nb: 2\n")
+		theirs := newTestKoanfURI(t, "theirs.yaml", "a: 1\nb: 2\n")
+
+		conflicts, err := ours.Merge3(newTestKoanfURI(t, "base.yaml", base), theirs)
+		require.NoError(t, err)
+		require.Empty(t, conflicts)
+		require.Equal(t, map[string]interface{}{"a": 1, "b": 2}, ours.konfig.Raw())
+	})
+}
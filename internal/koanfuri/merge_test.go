@@ -0,0 +1,834 @@
+package koanfuri
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestKoanfURI builds a KoanfURI from inline data, using name to hint the format.
+func newTestKoanfURI(t testing.TB, name string, data string) *KoanfURI {
+	t.Helper()
+	k := &KoanfURI{
+		konfig: koanf.New("."),
+		uri:    &url.URL{Scheme: "file", Path: "/" + name},
+	}
+	require.NoError(t, k.parseData([]byte(data)))
+	require.NoError(t, k.extractDirectives())
+	k.initProvenance()
+	return k
+}
+
+const testBasePlugins = `
+server:
+  plugins:
+    - name: auth
+      enabled: true
+      config:
+        timeout: 30
+    - name: logger
+      enabled: true
+`
+
+const testPatchPlugins = `
+server:
+  plugins:
+    - name: auth
+      config:
+        retries: 3
+    - name: cache
+      enabled: true
+`
+
+func TestMergeStrategies(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     MergeOptions
+		expected []interface{}
+	}{
+		{
+			name: "overwrite replaces the list",
+			opts: MergeOptions{Strategy: "overwrite"},
+			expected: []interface{}{
+				map[string]interface{}{"name": "auth", "config": map[string]interface{}{"retries": 3}},
+				map[string]interface{}{"name": "cache", "enabled": true},
+			},
+		},
+		{
+			name: "preserve appends to the list",
+			opts: MergeOptions{Strategy: "preserve"},
+			expected: []interface{}{
+				map[string]interface{}{"name": "auth", "enabled": true, "config": map[string]interface{}{"timeout": 30}},
+				map[string]interface{}{"name": "logger", "enabled": true},
+				map[string]interface{}{"name": "auth", "config": map[string]interface{}{"retries": 3}},
+				map[string]interface{}{"name": "cache", "enabled": true},
+			},
+		},
+		{
+			name: "keyed merges matching items",
+			opts: MergeOptions{Strategy: "keyed", MergeKey: "name"},
+			expected: []interface{}{
+				map[string]interface{}{"name": "auth", "enabled": true, "config": map[string]interface{}{"timeout": 30, "retries": 3}},
+				map[string]interface{}{"name": "logger", "enabled": true},
+				map[string]interface{}{"name": "cache", "enabled": true},
+			},
+		},
+		{
+			name: "keyed with an absent key appends",
+			opts: MergeOptions{Strategy: "keyed", MergeKey: "id"},
+			expected: []interface{}{
+				map[string]interface{}{"name": "auth", "enabled": true, "config": map[string]interface{}{"timeout": 30}},
+				map[string]interface{}{"name": "logger", "enabled": true},
+				map[string]interface{}{"name": "auth", "config": map[string]interface{}{"retries": 3}},
+				map[string]interface{}{"name": "cache", "enabled": true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			base := newTestKoanfURI(t, "base.yaml", testBasePlugins)
+			patch := newTestKoanfURI(t, "patch.yaml", testPatchPlugins)
+
+			require.NoError(t, base.Merge(patch, tt.opts))
+			require.Equal(t, tt.expected, base.GetKonfig().Get("server.plugins"))
+		})
+	}
+}
+
+func TestMergeKeyedNested(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", `
+services:
+  - id: 1
+    ports:
+      - id: 80
+        protocol: tcp
+`)
+	patch := newTestKoanfURI(t, "patch.json", `{"services": [{"id": 1, "ports": [{"id": 80, "protocol": "udp"}, {"id": 443}]}]}`)
+
+	require.NoError(t, base.Merge(patch, MergeOptions{Strategy: "keyed", MergeKey: "id"}))
+
+	services := base.GetKonfig().Get("services").([]interface{})
+	require.Len(t, services, 1)
+	ports := services[0].(map[string]interface{})["ports"].([]interface{})
+	require.Len(t, ports, 2)
+	require.Equal(t, "udp", ports[0].(map[string]interface{})["protocol"])
+}
+
+func TestMergeTombstone(t *testing.T) {
+	for _, strategy := range []string{"preserve", "overwrite", "keyed"} {
+		t.Run(strategy, func(t *testing.T) {
+			base := newTestKoanfURI(t, "base.yaml", "database:\n  host: localhost\n  password: secret\n")
+			patch := newTestKoanfURI(t, "patch.yaml", "database:\n  password: __TOMBSTONE__\n")
+
+			require.NoError(t, base.Merge(patch, MergeOptions{Strategy: strategy, MergeKey: "name"}))
+			require.False(t, base.GetKonfig().Exists("database.password"))
+			require.Equal(t, "localhost", base.GetKonfig().String("database.host"))
+		})
+	}
+}
+
+func TestMergeTombstonesInListItems(t *testing.T) {
+	base := `
+listeners:
+  - name: http
+    port: 80
+    tls:
+      enabled: false
+      cert: /etc/cert.pem
+`
+	patch := `
+listeners:
+  - name: http
+    port: 8080
+    tls:
+      cert: __TOMBSTONE__
+    debug: __TOMBSTONE__
+  - name: admin
+    port: 9000
+    options: [[__TOMBSTONE__, fast], [{mode: __TOMBSTONE__, level: 2}]]
+    literal: \__TOMBSTONE__
+`
+	admin := map[string]interface{}{
+		"name":    "admin",
+		"port":    9000,
+		"options": []interface{}{[]interface{}{"fast"}, []interface{}{map[string]interface{}{"level": 2}}},
+		"literal": "__TOMBSTONE__",
+	}
+
+	tests := []struct {
+		strategy string
+		expected []interface{}
+	}{
+		{
+			strategy: "overwrite",
+			expected: []interface{}{
+				map[string]interface{}{"name": "http", "port": 8080, "tls": map[string]interface{}{}},
+				admin,
+			},
+		},
+		{
+			strategy: "preserve",
+			expected: []interface{}{
+				map[string]interface{}{"name": "http", "port": 80, "tls": map[string]interface{}{"enabled": false, "cert": "/etc/cert.pem"}},
+				map[string]interface{}{"name": "http", "port": 8080, "tls": map[string]interface{}{}},
+				admin,
+			},
+		},
+		{
+			strategy: "keyed",
+			expected: []interface{}{
+				map[string]interface{}{"name": "http", "port": 8080, "tls": map[string]interface{}{"enabled": false}},
+				admin,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.strategy, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			require.NoError(t, k.Merge(newTestKoanfURI(t, "patch.yaml", patch), MergeOptions{Strategy: tc.strategy, MergeKey: "name"}))
+			require.Equal(t, tc.expected, k.GetKonfig().Get("listeners"))
+		})
+	}
+}
+
+func TestMergeInvalidOptions(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", "key: value\n")
+	patch := newTestKoanfURI(t, "patch.yaml", "key: other\n")
+
+	require.Error(t, base.Merge(patch, MergeOptions{Strategy: "bogus"}))
+	require.Error(t, base.Merge(patch, MergeOptions{Strategy: "keyed"}))
+	require.Error(t, base.Merge(nil, MergeOptions{Strategy: "overwrite"}))
+}
+
+func TestMergeRules(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", `
+server:
+  plugins:
+    - name: auth
+      enabled: true
+  allowlist: [10.0.0.0/8]
+ingress:
+  allowlist: [192.168.0.0/16]
+  hosts: [a.example.com]
+`)
+	patch := newTestKoanfURI(t, "patch.yaml", `
+server:
+  plugins:
+    - name: auth
+      enabled: false
+  allowlist: [172.16.0.0/12]
+ingress:
+  allowlist: [127.0.0.1/32]
+  hosts: [b.example.com]
+`)
+
+	opts := MergeOptions{
+		Strategy: "overwrite",
+		MergeKey: "name",
+		Rules: []MergeRule{
+			{Path: "server.plugins", Strategy: "keyed"},
+			{Path: "*.allowlist", Strategy: "preserve"},
+		},
+	}
+	require.NoError(t, base.Merge(patch, opts))
+
+	konfig := base.GetKonfig()
+	require.Equal(t, []interface{}{map[string]interface{}{"name": "auth", "enabled": false}}, konfig.Get("server.plugins"))
+	require.Equal(t, []interface{}{"10.0.0.0/8", "172.16.0.0/12"}, konfig.Get("server.allowlist"))
+	require.Equal(t, []interface{}{"192.168.0.0/16", "127.0.0.1/32"}, konfig.Get("ingress.allowlist"))
+	require.Equal(t, []interface{}{"b.example.com"}, konfig.Get("ingress.hosts"))
+
+	opts.Rules = []MergeRule{{Path: "server.plugins", Strategy: "bogus"}}
+	require.Error(t, base.Merge(patch, opts))
+}
+
+func TestMergeDirectives(t *testing.T) {
+	base := `
+server:
+  tls:
+    min_version: "1.2"
+    ciphers: [a, b]
+  plugins:
+    - name: auth
+      enabled: true
+  hosts: [a.example.com]
+`
+	tests := []struct {
+		name     string
+		patch    string
+		opts     MergeOptions
+		path     string
+		expected interface{}
+	}{
+		{
+			name:     "replace a map wholesale",
+			patch:    "server:\n  tls:\n    __MERGE__: replace\n    min_version: \"1.3\"\n",
+			opts:     MergeOptions{Strategy: "overwrite"},
+			path:     "server.tls",
+			expected: map[string]interface{}{"min_version": "1.3"},
+		},
+		{
+			name:     "append to a list under overwrite",
+			patch:    "server:\n  hosts:\n    __MERGE__: append\n    __VALUE__: [b.example.com]\n",
+			opts:     MergeOptions{Strategy: "overwrite"},
+			path:     "server.hosts",
+			expected: []interface{}{"a.example.com", "b.example.com"},
+		},
+		{
+			name:     "replace a list under preserve",
+			patch:    "server:\n  hosts:\n    __MERGE__: replace\n    __VALUE__: [b.example.com]\n",
+			opts:     MergeOptions{Strategy: "preserve"},
+			path:     "server.hosts",
+			expected: []interface{}{"b.example.com"},
+		},
+		{
+			name:     "keyed list with a merge key",
+			patch:    "server:\n  plugins:\n    __MERGE__: keyed\n    __MERGE_KEY__: name\n    __VALUE__:\n      - name: auth\n        enabled: false\n",
+			opts:     MergeOptions{Strategy: "overwrite"},
+			path:     "server.plugins",
+			expected: []interface{}{map[string]interface{}{"name": "auth", "enabled": false}},
+		},
+		{
+			name:     "directives are stripped from new keys",
+			patch:    "extra:\n  __MERGE__: replace\n  list:\n    __MERGE__: append\n    __VALUE__: [1]\n",
+			opts:     MergeOptions{Strategy: "overwrite"},
+			path:     "extra",
+			expected: map[string]interface{}{"list": []interface{}{1}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			patch := newTestKoanfURI(t, "patch.yaml", tt.patch)
+
+			require.NoError(t, k.Merge(patch, tt.opts))
+			require.Equal(t, tt.expected, k.GetKonfig().Get(tt.path))
+		})
+	}
+
+	k := newTestKoanfURI(t, "base.yaml", base)
+	patch := newTestKoanfURI(t, "patch.yaml", "server:\n  tls:\n    __MERGE__: bogus\n")
+	require.Error(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+}
+
+func TestMergePatchStrategy(t *testing.T) {
+	// Test cases from RFC 7386 Appendix A
+	tests := []struct {
+		name     string
+		target   string
+		patch    string
+		expected map[string]interface{}
+	}{
+		{
+			name:     "replace a value",
+			target:   `{"a": "b"}`,
+			patch:    `{"a": "c"}`,
+			expected: map[string]interface{}{"a": "c"},
+		},
+		{
+			name:     "null deletes a key",
+			target:   `{"a": "b", "b": "c"}`,
+			patch:    `{"a": null}`,
+			expected: map[string]interface{}{"b": "c"},
+		},
+		{
+			name:     "lists are replaced",
+			target:   `{"a": [{"b": "c"}]}`,
+			patch:    `{"a": [1]}`,
+			expected: map[string]interface{}{"a": []interface{}{float64(1)}},
+		},
+		{
+			name:     "nested null deletes",
+			target:   `{"a": {"b": "c"}}`,
+			patch:    `{"a": {"b": "d", "c": null}}`,
+			expected: map[string]interface{}{"a": map[string]interface{}{"b": "d"}},
+		},
+		{
+			name:     "null inside a new object is dropped",
+			target:   `{"e": null}`,
+			patch:    `{"a": {"bb": {"ccc": null}}}`,
+			expected: map[string]interface{}{"e": nil, "a": map[string]interface{}{"bb": map[string]interface{}{}}},
+		},
+		{
+			name:     "null inside a list is kept",
+			target:   `{"a": "b"}`,
+			patch:    `{"a": [{"b": null}]}`,
+			expected: map[string]interface{}{"a": []interface{}{map[string]interface{}{"b": nil}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "target.json", tt.target)
+			patch := newTestKoanfURI(t, "patch.json", tt.patch)
+
+			require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "merge-patch"}))
+			require.Equal(t, tt.expected, k.GetKonfig().Raw())
+		})
+	}
+
+	// Outside of merge-patch a null is an ordinary value
+	k := newTestKoanfURI(t, "target.json", `{"a": "b"}`)
+	patch := newTestKoanfURI(t, "patch.json", `{"a": null}`)
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, map[string]interface{}{"a": nil}, k.GetKonfig().Raw())
+}
+
+func TestMergeNullModes(t *testing.T) {
+	const base = "server:\n  host: localhost\n  port: 8080\n  debug: true\n"
+	const patch = `{"server": {"host": null, "port": null, "debug": null, "extra": null, "tags": [null]}}`
+
+	tests := []struct {
+		name     string
+		opts     MergeOptions
+		expected map[string]interface{}
+	}{
+		{
+			name:     "set by default",
+			opts:     MergeOptions{Strategy: "overwrite"},
+			expected: map[string]interface{}{"host": nil, "port": nil, "debug": nil, "extra": nil, "tags": []interface{}{nil}},
+		},
+		{
+			name:     "delete by default with merge-patch",
+			opts:     MergeOptions{Strategy: "merge-patch"},
+			expected: map[string]interface{}{"tags": []interface{}{nil}},
+		},
+		{
+			name:     "ignore",
+			opts:     MergeOptions{Strategy: "merge-patch", NullMode: "ignore"},
+			expected: map[string]interface{}{"host": "localhost", "port": 8080, "debug": true, "tags": []interface{}{nil}},
+		},
+		{
+			name: "rules pick the mode per path",
+			opts: MergeOptions{Strategy: "overwrite", NullMode: "delete", Rules: []MergeRule{
+				{Path: "server.host", Null: "ignore"},
+				{Path: "server.port", Null: "set"},
+				{Path: "server.*", Strategy: "preserve"},
+			}},
+			expected: map[string]interface{}{"host": "localhost", "port": nil, "tags": []interface{}{nil}},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			require.NoError(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), tc.opts))
+			require.Equal(t, tc.expected, k.konfig.Raw()["server"])
+		})
+	}
+
+	k := newTestKoanfURI(t, "base.yaml", base)
+	require.ErrorContains(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), MergeOptions{Strategy: "overwrite", NullMode: "drop"}), "invalid null mode: drop")
+	require.ErrorContains(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), MergeOptions{Strategy: "overwrite", Rules: []MergeRule{{Path: "server"}}}), "sets neither a strategy nor a null mode")
+}
+
+func TestMergeEmptyClears(t *testing.T) {
+	const base = `
+plugins: [auth, cache]
+extra_headers:
+  X-Trace: "on"
+servers:
+  - name: web
+    env: {DEBUG: "1"}
+`
+	const patch = `{"plugins": [], "extra_headers": {}, "servers": [{"name": "web", "env": {}}], "new": {}}`
+
+	for _, strategy := range []string{"overwrite", "preserve", "union", "keyed", "index"} {
+		t.Run(strategy, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			require.NoError(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), MergeOptions{Strategy: strategy, MergeKey: "name", EmptyClears: true}))
+
+			raw := k.konfig.Raw()
+			require.Equal(t, []interface{}{}, raw["plugins"])
+			require.Equal(t, map[string]interface{}{}, raw["extra_headers"])
+			require.Equal(t, map[string]interface{}{}, raw["new"])
+			if strategy == "keyed" || strategy == "index" {
+				require.Equal(t, []interface{}{map[string]interface{}{"name": "web", "env": map[string]interface{}{}}}, raw["servers"])
+			}
+		})
+	}
+
+	k := newTestKoanfURI(t, "base.yaml", base)
+	require.NoError(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), MergeOptions{Strategy: "preserve"}))
+	require.Equal(t, []interface{}{"auth", "cache"}, k.konfig.Get("plugins"))
+	require.Equal(t, map[string]interface{}{"X-Trace": "on"}, k.konfig.Get("extra_headers"))
+}
+
+func TestMergeKeyMatch(t *testing.T) {
+	const base = `
+database:
+  maxConns: 10
+  Host: localhost
+  retry_policy:
+    max_attempts: 3
+`
+	const patch = `{"DATABASE": {"max_conns": 20, "host": "db.internal", "retry-policy": {"MaxAttempts": 5}}}`
+
+	tests := []struct {
+		keyMatch string
+		expected map[string]interface{}
+	}{
+		{
+			keyMatch: "exact",
+			expected: map[string]interface{}{
+				"database": map[string]interface{}{"maxConns": 10, "Host": "localhost", "retry_policy": map[string]interface{}{"max_attempts": 3}},
+				"DATABASE": map[string]interface{}{"max_conns": float64(20), "host": "db.internal", "retry-policy": map[string]interface{}{"MaxAttempts": float64(5)}},
+			},
+		},
+		{
+			keyMatch: "insensitive",
+			expected: map[string]interface{}{
+				"database": map[string]interface{}{
+					"maxConns":     10,
+					"max_conns":    float64(20),
+					"Host":         "db.internal",
+					"retry_policy": map[string]interface{}{"max_attempts": 3},
+					"retry-policy": map[string]interface{}{"MaxAttempts": float64(5)},
+				},
+			},
+		},
+		{
+			keyMatch: "normalized",
+			expected: map[string]interface{}{
+				"database": map[string]interface{}{"maxConns": float64(20), "Host": "db.internal", "retry_policy": map[string]interface{}{"max_attempts": float64(5)}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.keyMatch, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			require.NoError(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), MergeOptions{Strategy: "overwrite", KeyMatch: tc.keyMatch}))
+			require.Equal(t, tc.expected, k.konfig.Raw())
+		})
+	}
+
+	k := newTestKoanfURI(t, "base.yaml", base)
+	require.ErrorContains(t, k.Merge(newTestKoanfURI(t, "patch.json", patch), MergeOptions{Strategy: "overwrite", KeyMatch: "fuzzy"}), "invalid key match mode: fuzzy")
+
+	// A patch spelling one key in two ways is ambiguous, whichever spelling would be merged last would win
+	k = newTestKoanfURI(t, "base.yaml", base)
+	require.ErrorContains(t, k.Merge(newTestKoanfURI(t, "patch.json", `{"database": {"maxConns": 2, "max-conns": 3}}`), MergeOptions{Strategy: "overwrite", KeyMatch: "normalized"}),
+		`patch keys "database.max-conns" and "database.maxConns" are the same key with normalized key matching`)
+	k = newTestKoanfURI(t, "base.yaml", base)
+	require.ErrorContains(t, k.Merge(newTestKoanfURI(t, "patch.json", `{"database": {"HOST": "a", "host": "b"}}`), MergeOptions{Strategy: "overwrite", KeyMatch: "insensitive"}),
+		`patch keys "database.HOST" and "database.host" are the same key with insensitive key matching`)
+}
+
+func TestMergePositionalDirectives(t *testing.T) {
+	base := `
+middleware:
+  - name: logger
+  - name: auth
+ports: [80, 443]
+`
+	tests := []struct {
+		name        string
+		patch       string
+		path        string
+		expected    interface{}
+		expectError bool
+	}{
+		{
+			name:     "prepend",
+			patch:    "middleware:\n  __MERGE__: prepend\n  __VALUE__:\n    - name: trace\n",
+			path:     "middleware",
+			expected: []interface{}{map[string]interface{}{"name": "trace"}, map[string]interface{}{"name": "logger"}, map[string]interface{}{"name": "auth"}},
+		},
+		{
+			name:     "insert before a keyed item",
+			patch:    "middleware:\n  __MERGE__: insert\n  __BEFORE__: logger\n  __VALUE__:\n    - name: cors\n",
+			path:     "middleware",
+			expected: []interface{}{map[string]interface{}{"name": "cors"}, map[string]interface{}{"name": "logger"}, map[string]interface{}{"name": "auth"}},
+		},
+		{
+			name:     "insert after a keyed item",
+			patch:    "middleware:\n  __MERGE__: insert\n  __AFTER__: logger\n  __VALUE__:\n    - name: cors\n",
+			path:     "middleware",
+			expected: []interface{}{map[string]interface{}{"name": "logger"}, map[string]interface{}{"name": "cors"}, map[string]interface{}{"name": "auth"}},
+		},
+		{
+			name:     "insert after a scalar",
+			patch:    "ports:\n  __MERGE__: insert\n  __AFTER__: 80\n  __VALUE__: 8080\n",
+			path:     "ports",
+			expected: []interface{}{80, 8080, 443},
+		},
+		{
+			name:     "insert at an index",
+			patch:    "ports:\n  __MERGE__: insert\n  __INDEX__: 2\n  __VALUE__: [8443]\n",
+			path:     "ports",
+			expected: []interface{}{80, 443, 8443},
+		},
+		{
+			name:     "replace at an index",
+			patch:    "middleware:\n  __MERGE__: replace\n  __INDEX__: 1\n  __VALUE__:\n    name: oauth\n",
+			path:     "middleware",
+			expected: []interface{}{map[string]interface{}{"name": "logger"}, map[string]interface{}{"name": "oauth"}},
+		},
+		{
+			name:        "missing anchor",
+			patch:       "middleware:\n  __MERGE__: insert\n  __BEFORE__: missing\n  __VALUE__: [x]\n",
+			expectError: true,
+		},
+		{
+			name:        "index out of range",
+			patch:       "ports:\n  __MERGE__: replace\n  __INDEX__: 2\n  __VALUE__: 1\n",
+			expectError: true,
+		},
+		{
+			name:        "ambiguous insert",
+			patch:       "ports:\n  __MERGE__: insert\n  __INDEX__: 0\n  __AFTER__: 80\n  __VALUE__: 1\n",
+			expectError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			patch := newTestKoanfURI(t, "patch.yaml", tt.patch)
+
+			err := k.Merge(patch, MergeOptions{Strategy: "overwrite", MergeKey: "name"})
+			if tt.expectError {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, k.GetKonfig().Get(tt.path))
+		})
+	}
+}
+
+func TestMergeUnionStrategy(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", `
+allowed_cidrs: [10.0.0.0/8, 192.168.0.0/16, 10.0.0.0/8]
+features:
+  - name: search
+    enabled: true
+ports: [80, 443]
+`)
+	patch := newTestKoanfURI(t, "patch.json", `{
+  "allowed_cidrs": ["172.16.0.0/12", "192.168.0.0/16"],
+  "features": [{"name": "search", "enabled": true}, {"name": "search", "enabled": false}],
+  "ports": [443, 8080]
+}`)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, base.Merge(patch, MergeOptions{Strategy: "union"}))
+	}
+
+	konfig := base.GetKonfig()
+	require.Equal(t, []interface{}{"10.0.0.0/8", "192.168.0.0/16", "172.16.0.0/12"}, konfig.Get("allowed_cidrs"))
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"name": "search", "enabled": true},
+		map[string]interface{}{"name": "search", "enabled": false},
+	}, konfig.Get("features"))
+	require.Equal(t, []interface{}{80, 443, float64(8080)}, konfig.Get("ports"))
+}
+
+func TestMergeIndexStrategy(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", `
+containers:
+  - name: app
+    image: app:1.0
+    env:
+      LOG_LEVEL: info
+    ports: [8080]
+  - name: sidecar
+    image: proxy:2.0
+args: [--verbose, --port=80]
+`)
+	patch := newTestKoanfURI(t, "patch.yaml", `
+containers:
+  - image: app:1.1
+    env:
+      DEBUG: "true"
+      LOG_LEVEL: __TOMBSTONE__
+    ports: [9090]
+  - {}
+  - name: metrics
+    image: exporter:0.5
+args: [--quiet]
+`)
+
+	require.NoError(t, base.Merge(patch, MergeOptions{Strategy: "index"}))
+
+	konfig := base.GetKonfig()
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"name": "app", "image": "app:1.1", "env": map[string]interface{}{"DEBUG": "true"}, "ports": []interface{}{9090}},
+		map[string]interface{}{"name": "sidecar", "image": "proxy:2.0"},
+		map[string]interface{}{"name": "metrics", "image": "exporter:0.5"},
+	}, konfig.Get("containers"))
+	require.Equal(t, []interface{}{"--quiet", "--port=80"}, konfig.Get("args"))
+}
+
+func TestMergeListTombstones(t *testing.T) {
+	base := `
+plugins:
+  - name: auth
+    enabled: true
+  - name: logger
+    enabled: true
+  - name: metrics
+    enabled: false
+cidrs: [10.0.0.0/8, 192.168.0.0/16]
+`
+	tests := []struct {
+		name     string
+		patch    string
+		strategy string
+		path     string
+		expected interface{}
+	}{
+		{
+			name:     "remove a map by merge key",
+			patch:    "plugins:\n  - __TOMBSTONE__: logger\n",
+			strategy: "overwrite",
+			path:     "plugins",
+			expected: []interface{}{
+				map[string]interface{}{"name": "auth", "enabled": true},
+				map[string]interface{}{"name": "metrics", "enabled": false},
+			},
+		},
+		{
+			name:     "remove maps by matching fields",
+			patch:    "plugins:\n  - __TOMBSTONE__:\n      enabled: true\n",
+			strategy: "preserve",
+			path:     "plugins",
+			expected: []interface{}{
+				map[string]interface{}{"name": "metrics", "enabled": false},
+			},
+		},
+		{
+			name:     "remove a scalar and append another",
+			patch:    "cidrs:\n  - __TOMBSTONE__: 10.0.0.0/8\n  - 172.16.0.0/12\n",
+			strategy: "preserve",
+			path:     "cidrs",
+			expected: []interface{}{"192.168.0.0/16", "172.16.0.0/12"},
+		},
+		{
+			name:     "remove and merge with keyed",
+			patch:    "plugins:\n  - __TOMBSTONE__: auth\n  - name: metrics\n    enabled: true\n",
+			strategy: "keyed",
+			path:     "plugins",
+			expected: []interface{}{
+				map[string]interface{}{"name": "logger", "enabled": true},
+				map[string]interface{}{"name": "metrics", "enabled": true},
+			},
+		},
+		{
+			name:     "tombstones mixed with items under overwrite",
+			patch:    "cidrs:\n  - __TOMBSTONE__: 10.0.0.0/8\n  - 172.16.0.0/12\n",
+			strategy: "overwrite",
+			path:     "cidrs",
+			expected: []interface{}{"172.16.0.0/12"},
+		},
+		{
+			name:     "tombstones in a new list are dropped",
+			patch:    "extra:\n  - __TOMBSTONE__: x\n  - y\n",
+			strategy: "overwrite",
+			path:     "extra",
+			expected: []interface{}{"y"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			patch := newTestKoanfURI(t, "patch.yaml", tt.patch)
+
+			require.NoError(t, k.Merge(patch, MergeOptions{Strategy: tt.strategy, MergeKey: "name"}))
+			require.Equal(t, tt.expected, k.GetKonfig().Get(tt.path))
+		})
+	}
+}
+
+func TestMergeTombstoneMarker(t *testing.T) {
+	base := newTestKoanfURI(t, "base.yaml", `
+database:
+  host: localhost
+  password: secret
+  note: keep
+plugins: [auth, logger]
+`)
+	patch := newTestKoanfURI(t, "patch.yaml", `
+database:
+  password: ~delete~
+  note: __TOMBSTONE__
+  escaped: \~delete~
+  double: \\~delete~
+plugins:
+  - ~delete~: logger
+`)
+
+	require.NoError(t, base.Merge(patch, MergeOptions{Strategy: "overwrite", TombstoneMarker: "~delete~"}))
+	require.Equal(t, map[string]interface{}{
+		"database": map[string]interface{}{
+			"host":    "localhost",
+			"note":    "__TOMBSTONE__",
+			"escaped": "~delete~",
+			"double":  `\~delete~`,
+		},
+		"plugins": []interface{}{"auth"},
+	}, base.GetKonfig().Raw())
+
+	// The default marker can be escaped the same way
+	base = newTestKoanfURI(t, "base.yaml", "key: value\n")
+	patch = newTestKoanfURI(t, "patch.yaml", "key: \\__TOMBSTONE__\nlist: [\\__TOMBSTONE__]\n")
+	require.NoError(t, base.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, "__TOMBSTONE__", base.GetKonfig().String("key"))
+	require.Equal(t, []interface{}{"__TOMBSTONE__"}, base.GetKonfig().Get("list"))
+}
+
+func TestMergeTypeConflicts(t *testing.T) {
+	base := `
+database:
+  host: localhost
+  port: 5432
+servers: [a, b]
+timeout: 30
+`
+	tests := []struct {
+		name     string
+		patch    string
+		conflict bool
+	}{
+		{name: "map replaced by scalar", patch: "database: postgres://localhost\n", conflict: true},
+		{name: "list replaced by map", patch: "servers:\n  a: 1\n", conflict: true},
+		{name: "number replaced by string", patch: "database:\n  port: \"5432\"\n", conflict: true},
+		{name: "list wrapper replaced by map", patch: "servers:\n  __MERGE__: replace\n  __VALUE__:\n    a: 1\n", conflict: true},
+		{name: "int replaced by float", patch: "timeout: 2.5\n", conflict: false},
+		{name: "value replaced by null", patch: "timeout: null\n", conflict: false},
+		{name: "tombstone", patch: "database: __TOMBSTONE__\n", conflict: false},
+		{name: "same types", patch: "database:\n  host: db\nservers: [c]\n", conflict: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, policy := range []string{"", "replace", "warn", "error"} {
+				k := newTestKoanfURI(t, "base.yaml", base)
+				patch := newTestKoanfURI(t, "patch.yaml", tt.patch)
+
+				err := k.Merge(patch, MergeOptions{Strategy: "overwrite", OnTypeConflict: policy})
+				if tt.conflict && policy == "error" {
+					require.Error(t, err)
+					require.Contains(t, err.Error(), "/base.yaml")
+					require.Contains(t, err.Error(), "/patch.yaml")
+					continue
+				}
+				require.NoError(t, err, policy)
+			}
+		})
+	}
+
+	k := newTestKoanfURI(t, "base.yaml", base)
+	patch := newTestKoanfURI(t, "patch.yaml", "database: postgres://localhost\n")
+	err := k.Merge(patch, MergeOptions{Strategy: "overwrite", OnTypeConflict: "error"})
+	require.ErrorContains(t, err, `type conflict at "database": map`)
+
+	require.Error(t, k.Merge(patch, MergeOptions{Strategy: "overwrite", OnTypeConflict: "bogus"}))
+}
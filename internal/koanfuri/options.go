@@ -0,0 +1,105 @@
+package koanfuri
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// InputOptions are settings given to a single input after its URI, separated by semicolons, e.g.
+//
+//	overrides.yaml;format=yaml;strategy=preserve;key=id;optional;mount=services.api
+//
+// format picks the parser like a scheme hint does, and is the only way to hint the format of stdin ("-;format=yaml").
+// strategy and key override the list merge strategy and merge key for this patch only. optional skips the input
+// when it doesn't exist instead of failing. mount places the whole document under a key path.
+type InputOptions struct {
+	Format   string
+	Strategy string
+	MergeKey string
+	Optional bool
+	Mount    string
+}
+
+// inputOptionNames are the options an input accepts after its URI.
+var inputOptionNames = []string{"format", "strategy", "key", "mount", "optional"}
+
+// parseInputOptions splits the options off an input argument and returns the URI and its options. Only the trailing
+// semicolon separated parts named after a known option are options, so semicolons elsewhere stay in the URI, e.g. in
+// file names, HTTP matrix parameters or S3 object keys.
+func parseInputOptions(input string) (string, InputOptions, error) {
+	parts := strings.Split(input, ";")
+	start := len(parts)
+	for start > 1 {
+		name, _, _ := strings.Cut(parts[start-1], "=")
+		if parts[start-1] != "" && !slices.Contains(inputOptionNames, name) {
+			break
+		}
+		start--
+	}
+	uri, rest := strings.Join(parts[:start], ";"), parts[start:]
+	var opts InputOptions
+	for _, option := range rest {
+		if option == "" {
+			continue
+		}
+		name, value, hasValue := strings.Cut(option, "=")
+		switch name {
+		case "format", "strategy", "key", "mount":
+			if value == "" {
+				return "", InputOptions{}, fmt.Errorf("input option %s requires a value", name)
+			}
+		}
+
+		switch name {
+		case "format":
+			opts.Format = strings.ToLower(value)
+		case "strategy":
+			opts.Strategy = value
+		case "key":
+			opts.MergeKey = value
+		case "mount":
+			opts.Mount = value
+		case "optional":
+			opts.Optional = true
+			if hasValue {
+				optional, err := strconv.ParseBool(value)
+				if err != nil {
+					return "", InputOptions{}, fmt.Errorf("input option optional must be true or false, got %q", value)
+				}
+				opts.Optional = optional
+			}
+		}
+	}
+	return uri, opts, nil
+}
+
+// Options returns the options given to the input after its URI.
+func (k *KoanfURI) Options() InputOptions {
+	return k.options
+}
+
+// mount moves the document under the mount key path, along with the keys it locks, which are relative to the document.
+func (k *KoanfURI) mount() error {
+	if k.options.Mount == "" {
+		return nil
+	}
+	if k.IsJSONPatch() {
+		return fmt.Errorf("%s is a JSON Patch document and cannot be mounted", k)
+	}
+
+	path := splitPath(k.options.Mount)
+	var root interface{} = k.konfig.Raw()
+	for i := len(path) - 1; i >= 0; i-- {
+		root = map[string]interface{}{path[i]: root}
+	}
+	if err := k.reload(root.(map[string]interface{})); err != nil {
+		return fmt.Errorf("failed to mount %s at %q: %w", k, k.options.Mount, err)
+	}
+
+	for i, pattern := range k.locked {
+		k.locked[i] = joinPath(path) + "." + pattern
+	}
+	return nil
+}
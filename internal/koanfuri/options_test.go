@@ -0,0 +1,87 @@
+package koanfuri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseInputOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		uri      string
+		expected InputOptions
+		err      string
+	}{
+		{input: "base.yaml", uri: "base.yaml"},
+		{input: "-;format=YAML", uri: "-", expected: InputOptions{Format: "yaml"}},
+		{
+			input:    "overrides.yaml;format=yaml;strategy=keyed;key=id;optional;mount=services.api",
+			uri:      "overrides.yaml",
+			expected: InputOptions{Format: "yaml", Strategy: "keyed", MergeKey: "id", Optional: true, Mount: "services.api"},
+		},
+		{input: "a.yaml;optional=false;", uri: "a.yaml"},
+		{input: "a.yaml;optional=maybe", err: "optional must be true or false"},
+		{input: "a.yaml;mount=", err: "mount requires a value"},
+		{input: "a.yaml;key", err: "key requires a value"},
+		{input: "a.yaml;colour=blue", uri: "a.yaml;colour=blue"},
+		{input: "semi;colon.yaml", uri: "semi;colon.yaml"},
+		{input: "semi;colon.yaml;optional", uri: "semi;colon.yaml", expected: InputOptions{Optional: true}},
+		{input: "https://example.com/config;v=2;format=json", uri: "https://example.com/config;v=2", expected: InputOptions{Format: "json"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			uri, opts, err := parseInputOptions(tt.input)
+			if tt.err != "" {
+				require.ErrorContains(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.uri, uri)
+			require.Equal(t, tt.expected, opts)
+		})
+	}
+}
+
+func TestNewKoanfURIWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "api.conf")
+	require.NoError(t, os.WriteFile(path, []byte("__LOCKED__: [port]\nport: 80\n"), 0o644))
+
+	t.Run("format and mount", func(t *testing.T) {
+		k, err := NewKoanfURI(path + `;format=yaml;mount=services."api.v1"`)
+		require.NoError(t, err)
+		require.Equal(t, "yaml", k.GetDataFormat())
+		require.Equal(t, map[string]interface{}{
+			"services": map[string]interface{}{"api.v1": map[string]interface{}{"port": 80}},
+		}, k.konfig.Raw())
+		require.Equal(t, []string{`services."api.v1".port`}, k.locked)
+		require.Equal(t, "file://"+path, k.originOf([]string{"services", "api.v1", "port"}).URI)
+	})
+
+	t.Run("format conflicts with scheme hint", func(t *testing.T) {
+		_, err := NewKoanfURI("file+json://" + path + ";format=yaml")
+		require.ErrorContains(t, err, "conflicts with scheme hint")
+	})
+
+	t.Run("semicolon in file name", func(t *testing.T) {
+		path := filepath.Join(dir, "semi;colon.yaml")
+		require.NoError(t, os.WriteFile(path, []byte("port: 80\n"), 0o644))
+
+		k, err := NewKoanfURI(path)
+		require.NoError(t, err)
+		require.Equal(t, map[string]interface{}{"port": 80}, k.konfig.Raw())
+	})
+
+	t.Run("optional missing input", func(t *testing.T) {
+		k, err := NewKoanfURI(filepath.Join(dir, "missing.yaml") + ";optional")
+		require.NoError(t, err)
+		require.Empty(t, k.konfig.Raw())
+
+		_, err = NewKoanfURI(filepath.Join(dir, "missing.yaml"))
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,396 @@
+package koanfuri
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/knadh/koanf/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// override is a single "--set path=value" or "--unset path" operation.
+type override struct {
+	expr  string
+	steps []pathStep
+	value interface{}
+	unset bool
+}
+
+// pathStep is a segment of an override path: a map key, or a list item selected by index or by the value of one of
+// its fields, e.g. "servers", "[2]" or "[name=web]".
+type pathStep struct {
+	key   string
+	list  bool
+	index int
+	field string
+	match string
+}
+
+// NewOverrides creates a KoanfURI holding --set and --unset operations. Merging it applies every set, in order, then
+// every unset, following the type conflict policy, null mode and key matching of the merge. Values are parsed as YAML,
+// so "port=8080" sets a number and "tags=[a, b]" a list.
+//
+// Paths are key paths (see splitPath) whose segments may be followed by list selectors: "[n]" selects the item at index
+// n and "[field=value]" the first map item whose field has that value, e.g. "servers[name=web].port=8080". Setting the
+// index one past the end of a list appends to it. Selector values may contain dots, and brackets outside a selector are
+// an error. Unsetting a key or item that doesn't exist does nothing.
+func NewOverrides(set, unset []string) (*KoanfURI, error) {
+	k := &KoanfURI{
+		konfig: koanf.New("."),
+		uri:    &url.URL{Scheme: "cli", Opaque: "--set"},
+	}
+
+	for _, expr := range set {
+		path, value, ok := splitOverride(expr)
+		if !ok {
+			return nil, fmt.Errorf("invalid --set %q: expected path=value", expr)
+		}
+		steps, err := parseOverridePath(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --set %q: %w", expr, err)
+		}
+		var parsed interface{}
+		if err := yaml.Unmarshal([]byte(value), &parsed); err != nil {
+			return nil, fmt.Errorf("invalid --set %q: %w", expr, err)
+		}
+		k.overrides = append(k.overrides, override{expr: expr, steps: steps, value: parsed})
+	}
+
+	for _, expr := range unset {
+		steps, err := parseOverridePath(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --unset %q: %w", expr, err)
+		}
+		k.overrides = append(k.overrides, override{expr: expr, steps: steps, unset: true})
+	}
+
+	k.initProvenance()
+	return k, nil
+}
+
+// splitOverride splits "path=value" at the first "=" outside of quotes and list selectors.
+func splitOverride(expr string) (string, string, bool) {
+	quoted, depth := false, 0
+	for i := 0; i < len(expr); i++ {
+		switch c := expr[i]; {
+		case c == '\\' && quoted:
+			i++
+		case c == '"':
+			quoted = !quoted
+		case c == '[' && !quoted:
+			depth++
+		case c == ']' && !quoted && depth > 0:
+			depth--
+		case c == '=' && !quoted && depth == 0:
+			return expr[:i], expr[i+1:], i > 0
+		}
+	}
+	return "", "", false
+}
+
+// parseOverridePath parses a key path with optional list selectors into its steps.
+func parseOverridePath(path string) ([]pathStep, error) {
+	var steps []pathStep
+	for _, segment := range splitOverridePath(path) {
+		key, selectors, err := splitSelectors(segment)
+		if err != nil {
+			return nil, fmt.Errorf("invalid path %q: %w", path, err)
+		}
+		if key == "" && (len(selectors) == 0 || len(steps) == 0) {
+			return nil, fmt.Errorf("empty key in path %q", path)
+		}
+		if key != "" {
+			steps = append(steps, pathStep{key: key})
+		}
+		for _, selector := range selectors {
+			step, err := parseSelector(selector)
+			if err != nil {
+				return nil, err
+			}
+			steps = append(steps, step)
+		}
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return steps, nil
+}
+
+// splitOverridePath splits an override path at the dots outside of quotes and list selectors, so that a selector such
+// as "[host=web.example.com]" stays in one segment. Segments are returned as written, quotes included.
+func splitOverridePath(path string) []string {
+	if path == "" {
+		return nil
+	}
+
+	var segments []string
+	start, quoted, escaped, inSelector := 0, false, false, false
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && c == '\\':
+			escaped = true
+		case c == '"' && (quoted || inSelector || i == start):
+			quoted = !quoted
+		case quoted:
+		case c == '[':
+			inSelector = true
+		case c == ']':
+			inSelector = false
+		case c == '.' && !inSelector:
+			segments = append(segments, path[start:i])
+			start = i + 1
+		}
+	}
+	return append(segments, path[start:])
+}
+
+// splitSelectors splits a path segment such as "servers[name=web][0]" or `"app.kubernetes.io/name"` into its key and
+// the contents of its selectors. Brackets that don't form a selector are an error rather than part of the key.
+func splitSelectors(segment string) (string, []string, error) {
+	var key, rest string
+	if strings.HasPrefix(segment, `"`) {
+		end := closingQuote(segment, 0)
+		if end < 0 {
+			// An unterminated quote runs to the end of the path, as in splitPath
+			return splitPath(segment)[0], nil, nil
+		}
+		key, rest = splitPath(segment[:end+1])[0], segment[end+1:]
+	} else {
+		start := strings.IndexByte(segment, '[')
+		if start < 0 {
+			start = len(segment)
+		}
+		key, rest = segment[:start], segment[start:]
+		if strings.ContainsAny(key, `]"`) {
+			return "", nil, fmt.Errorf("invalid key %q", segment)
+		}
+	}
+
+	var selectors []string
+	for rest != "" {
+		if rest[0] != '[' {
+			return "", nil, fmt.Errorf("invalid list selector in %q", segment)
+		}
+		end := strings.IndexByte(rest, ']')
+		if quote := strings.IndexByte(rest, '"'); quote >= 0 && quote < end {
+			// A quoted selector value may contain "]"
+			if closing := closingQuote(rest, quote); closing >= 0 {
+				end = closing + 1 + strings.IndexByte(rest[closing+1:], ']')
+			}
+		}
+		if end <= 0 || rest[end] != ']' {
+			return "", nil, fmt.Errorf("invalid list selector in %q", segment)
+		}
+		selectors = append(selectors, rest[1:end])
+		rest = rest[end+1:]
+	}
+	return key, selectors, nil
+}
+
+// closingQuote returns the index of the double quote closing the one at start, or -1 if there is none. A backslash
+// escapes the next character.
+func closingQuote(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseSelector parses the contents of a list selector, either an index or field=value.
+func parseSelector(selector string) (pathStep, error) {
+	if field, match, ok := strings.Cut(selector, "="); ok {
+		if field == "" {
+			return pathStep{}, fmt.Errorf("invalid list selector [%s]: missing field", selector)
+		}
+		return pathStep{list: true, index: -1, field: field, match: strings.Trim(match, `"`)}, nil
+	}
+	index, err := strconv.Atoi(selector)
+	if err != nil || index < 0 {
+		return pathStep{}, fmt.Errorf("invalid list selector [%s]: expected an index or field=value", selector)
+	}
+	return pathStep{list: true, index: index}, nil
+}
+
+// String returns the selector form of the step.
+func (s pathStep) String() string {
+	switch {
+	case !s.list:
+		return joinPath([]string{s.key})
+	case s.index >= 0:
+		return fmt.Sprintf("[%d]", s.index)
+	default:
+		return fmt.Sprintf("[%s=%s]", s.field, s.match)
+	}
+}
+
+// applyOverrides applies the --set and --unset operations of other to the configuration. They follow the type conflict
+// policy, null mode and key matching of opts like a patch does.
+func (k *KoanfURI) applyOverrides(other *KoanfURI, opts MergeOptions) error {
+	var root interface{} = k.konfig.Raw()
+
+	m := &merger{opts: opts, dest: k, src: other}
+	for _, o := range other.overrides {
+		if o.unset {
+			root = m.unsetStep(root, o.steps, nil, false)
+			continue
+		}
+		var err error
+		if root, err = m.setStep(root, o.steps, deepCopy(o.value), nil, false); err != nil {
+			return fmt.Errorf("--set %q failed: %w", o.expr, err)
+		}
+	}
+
+	if err := k.reload(root.(map[string]interface{})); err != nil {
+		return fmt.Errorf("failed to load overridden configuration: %w", err)
+	}
+	k.trackChanges(other, m.changes)
+	return nil
+}
+
+// setStep stores value at steps below node and returns the updated node. Missing map keys are created. path is the key
+// path of node, and inList tells whether node is inside a list: lists are leaves for provenance, so their items share
+// the path of the list, which is recorded as changed instead of the keys below it.
+func (m *merger) setStep(node interface{}, steps []pathStep, value interface{}, path []string, inList bool) (interface{}, error) {
+	step := steps[0]
+
+	if !step.list {
+		if node == nil {
+			node = make(map[string]interface{})
+		}
+		mp, ok := node.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("cannot set %s in a %s", step, typeName(node))
+		}
+		key := m.destKey(mp, step.key)
+		keyPath := path
+		if !inList {
+			keyPath = childPath(path, key)
+		}
+
+		if len(steps) > 1 {
+			child, err := m.setStep(mp[key], steps[1:], value, keyPath, inList)
+			if err != nil {
+				return nil, err
+			}
+			mp[key] = child
+			return mp, nil
+		}
+
+		// Nulls inside lists are always kept, like in patches
+		if value == nil && !inList {
+			switch m.nullMode(keyPath) {
+			case "delete":
+				delete(mp, key)
+				m.record(keyPath, true)
+				return mp, nil
+			case "ignore":
+				return mp, nil
+			}
+		}
+		if existing, ok := mp[key]; ok {
+			if err := m.checkTypeConflict(keyPath, existing, value); err != nil {
+				return nil, err
+			}
+		}
+		mp[key] = value
+		if !inList {
+			m.record(keyPath, false)
+		}
+		return mp, nil
+	}
+
+	list, ok := node.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("cannot select %s in a %s", step, typeName(node))
+	}
+	idx := step.index
+	if idx < 0 {
+		if idx = findKeyedItem(list, step.field, step.match); idx < 0 {
+			return nil, fmt.Errorf("no list item matches %s", step)
+		}
+	}
+	if idx > len(list) {
+		return nil, fmt.Errorf("index %d out of range for list of length %d", idx, len(list))
+	}
+	if idx == len(list) {
+		list = append(list, nil)
+	}
+
+	if len(steps) > 1 {
+		child, err := m.setStep(list[idx], steps[1:], value, path, true)
+		if err != nil {
+			return nil, err
+		}
+		list[idx] = child
+	} else {
+		if err := m.checkTypeConflict(path, list[idx], value); err != nil {
+			return nil, err
+		}
+		list[idx] = value
+	}
+	if !inList {
+		m.record(path, false)
+	}
+	return list, nil
+}
+
+// unsetStep removes the key or list item at steps below node and returns the updated node. Paths that don't exist are
+// left alone. path and inList are the same as for setStep.
+func (m *merger) unsetStep(node interface{}, steps []pathStep, path []string, inList bool) interface{} {
+	step := steps[0]
+
+	if !step.list {
+		mp, ok := node.(map[string]interface{})
+		if !ok {
+			return node
+		}
+		key := m.destKey(mp, step.key)
+		child, exists := mp[key]
+		if !exists {
+			return node
+		}
+		keyPath := path
+		if !inList {
+			keyPath = childPath(path, key)
+		}
+		if len(steps) == 1 {
+			delete(mp, key)
+			if !inList {
+				m.record(keyPath, true)
+			}
+		} else {
+			mp[key] = m.unsetStep(child, steps[1:], keyPath, inList)
+		}
+		return mp
+	}
+
+	list, ok := node.([]interface{})
+	if !ok {
+		return node
+	}
+	idx := step.index
+	if idx < 0 {
+		idx = findKeyedItem(list, step.field, step.match)
+	}
+	if idx < 0 || idx >= len(list) {
+		return node
+	}
+	if !inList {
+		m.record(path, false)
+	}
+	if len(steps) == 1 {
+		return append(list[:idx], list[idx+1:]...)
+	}
+	list[idx] = m.unsetStep(list[idx], steps[1:], path, true)
+	return list
+}
@@ -0,0 +1,274 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOverrides(t *testing.T) {
+	const base = `
+servers:
+  - name: web
+    port: 80
+  - name: api
+    port: 8080
+plugins:
+  - name: auth
+    enabled: true
+  - name: cache
+    enabled: true
+  - name: logger
+    enabled: true
+metadata:
+  labels:
+    app.kubernetes.io/name: shop
+hosts:
+  - host: web.example.com
+    port: 80
+  - host: api.example.com
+    port: 81
+`
+	tests := []struct {
+		name     string
+		set      []string
+		unset    []string
+		path     string
+		expected interface{}
+		err      string
+	}{
+		{
+			name:     "typed scalar",
+			set:      []string{"servers[name=web].port=8443"},
+			path:     "servers",
+			expected: []interface{}{map[string]interface{}{"name": "web", "port": 8443}, map[string]interface{}{"name": "api", "port": 8080}},
+		},
+		{
+			name:     "index selector",
+			set:      []string{"plugins[2].enabled=false"},
+			path:     "plugins",
+			expected: []interface{}{map[string]interface{}{"name": "auth", "enabled": true}, map[string]interface{}{"name": "cache", "enabled": true}, map[string]interface{}{"name": "logger", "enabled": false}},
+		},
+		{
+			name:     "new keys and YAML values",
+			set:      []string{"server.tls.ciphers=[aes, chacha]", `server.name="8080"`, "server.motd=a=b"},
+			path:     "server",
+			expected: map[string]interface{}{"tls": map[string]interface{}{"ciphers": []interface{}{"aes", "chacha"}}, "name": "8080", "motd": "a=b"},
+		},
+		{
+			name:     "append to a list",
+			set:      []string{"servers[2]={name: admin, port: 9000}"},
+			path:     "servers",
+			expected: []interface{}{map[string]interface{}{"name": "web", "port": 80}, map[string]interface{}{"name": "api", "port": 8080}, map[string]interface{}{"name": "admin", "port": 9000}},
+		},
+		{
+			name:     "quoted keys",
+			set:      []string{`metadata.labels."app.kubernetes.io/name"=checkout`},
+			path:     "metadata",
+			expected: map[string]interface{}{"labels": map[string]interface{}{"app.kubernetes.io/name": "checkout"}},
+		},
+		{
+			name:     "selector values containing dots",
+			set:      []string{"hosts[host=web.example.com].port=8080", `hosts[host="api.example.com"].tls=true`},
+			path:     "hosts",
+			expected: []interface{}{map[string]interface{}{"host": "web.example.com", "port": 8080}, map[string]interface{}{"host": "api.example.com", "port": 81, "tls": true}},
+		},
+		{
+			name:     "unset keys and items",
+			unset:    []string{"plugins[name=cache]", "plugins[0].enabled", "servers[name=missing]", "nothing.here"},
+			path:     "plugins",
+			expected: []interface{}{map[string]interface{}{"name": "auth"}, map[string]interface{}{"name": "logger", "enabled": true}},
+		},
+		{
+			name:  "sets apply before unsets",
+			set:   []string{"metadata.owner=team"},
+			unset: []string{"metadata"},
+			path:  "metadata",
+		},
+		{
+			name: "no matching item",
+			set:  []string{"servers[name=admin].port=1"},
+			err:  `--set "servers[name=admin].port=1" failed: no list item matches [name=admin]`,
+		},
+		{
+			name: "index out of range",
+			set:  []string{"plugins[5].enabled=true"},
+			err:  "index 5 out of range for list of length 3",
+		},
+		{
+			name: "selector on a map",
+			set:  []string{"metadata[0]=x"},
+			err:  "cannot select [0] in a map",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			overrides, err := NewOverrides(tc.set, tc.unset)
+			require.NoError(t, err)
+
+			err = k.Merge(overrides, MergeOptions{Strategy: "overwrite"})
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, k.konfig.Raw()[tc.path])
+		})
+	}
+}
+
+func TestOverridesParsing(t *testing.T) {
+	tests := []struct {
+		set   []string
+		unset []string
+		err   string
+	}{
+		{set: []string{"port"}, err: "expected path=value"},
+		{set: []string{"=1"}, err: "expected path=value"},
+		{set: []string{"a..b=1"}, err: "empty key"},
+		{set: []string{"[0]=1"}, err: "empty key"},
+		{set: []string{"a[x]=1"}, err: "expected an index or field=value"},
+		{set: []string{"a[=x]=1"}, err: "missing field"},
+		{set: []string{"a[0]b]=1"}, err: "invalid list selector"},
+		{set: []string{"a={b"}, err: "invalid --set"},
+		{unset: []string{""}, err: "empty path"},
+		{unset: []string{"a]b"}, err: `invalid key "a]b"`},
+		{unset: []string{"a[0]x"}, err: "invalid list selector"},
+		{unset: []string{"a[0"}, err: "invalid list selector"},
+		{unset: []string{"hosts[host=web.example.com"}, err: "invalid list selector"},
+	}
+
+	for _, tc := range tests {
+		_, err := NewOverrides(tc.set, tc.unset)
+		require.ErrorContains(t, err, tc.err, "set %v unset %v", tc.set, tc.unset)
+	}
+}
+
+func TestOverridesProvenance(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "server:\n  port: 80\n  host: localhost\nplugins: [auth]\n")
+	overrides, err := NewOverrides([]string{"server.port=8080", "plugins[1]=cache"}, []string{"server.host"})
+	require.NoError(t, err)
+	require.NoError(t, k.Merge(overrides, MergeOptions{Strategy: "overwrite"}))
+
+	require.Equal(t, map[string]string{
+		"server.port": "cli:--set",
+		"plugins":     "cli:--set",
+	}, origins(k))
+}
+
+func TestOverridesMergeOptions(t *testing.T) {
+	const base = "server:\n  port: 80\n  host: localhost\nsecurity:\n  tls: true\nplugins: [auth]\n"
+
+	tests := []struct {
+		name     string
+		set      []string
+		unset    []string
+		opts     MergeOptions
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name: "type conflict error",
+			set:  []string{"security=oops"},
+			opts: MergeOptions{OnTypeConflict: "error"},
+			err:  `type conflict at "security": map from file:///base.yaml would be replaced by string from cli:--set`,
+		},
+		{
+			name: "type conflict in a list",
+			set:  []string{"plugins[0]={name: auth}"},
+			opts: MergeOptions{OnTypeConflict: "error"},
+			err:  `type conflict at "plugins": string from file:///base.yaml would be replaced by map from cli:--set`,
+		},
+		{
+			name: "type conflict replace",
+			set:  []string{"security=oops"},
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"port": 80, "host": "localhost"},
+				"security": "oops",
+				"plugins":  []interface{}{"auth"},
+			},
+		},
+		{
+			name: "null mode delete",
+			set:  []string{"server.port=null"},
+			opts: MergeOptions{NullMode: "delete"},
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"host": "localhost"},
+				"security": map[string]interface{}{"tls": true},
+				"plugins":  []interface{}{"auth"},
+			},
+		},
+		{
+			name: "null mode ignore",
+			set:  []string{"server.port=null"},
+			opts: MergeOptions{NullMode: "ignore"},
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"port": 80, "host": "localhost"},
+				"security": map[string]interface{}{"tls": true},
+				"plugins":  []interface{}{"auth"},
+			},
+		},
+		{
+			name: "null mode rule",
+			set:  []string{"server.port=null", "server.host=null"},
+			opts: MergeOptions{Rules: []MergeRule{{Path: "server.host", Null: "delete"}}},
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"port": nil},
+				"security": map[string]interface{}{"tls": true},
+				"plugins":  []interface{}{"auth"},
+			},
+		},
+		{
+			name:  "key matching",
+			set:   []string{"Server.Port=1", "SECURITY.tls=false"},
+			unset: []string{"server.HOST"},
+			opts:  MergeOptions{KeyMatch: "insensitive"},
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"port": 1},
+				"security": map[string]interface{}{"tls": false},
+				"plugins":  []interface{}{"auth"},
+			},
+		},
+		{
+			name: "exact key matching",
+			set:  []string{"Server.port=1"},
+			expected: map[string]interface{}{
+				"server":   map[string]interface{}{"port": 80, "host": "localhost"},
+				"Server":   map[string]interface{}{"port": 1},
+				"security": map[string]interface{}{"tls": true},
+				"plugins":  []interface{}{"auth"},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			overrides, err := NewOverrides(tc.set, tc.unset)
+			require.NoError(t, err)
+
+			tc.opts.Strategy = "overwrite"
+			err = k.Merge(overrides, tc.opts)
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, k.konfig.Raw())
+		})
+	}
+}
+
+func TestOverridesProvenanceKeyMatching(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "server:\n  port: 80\n  host: localhost\n")
+	overrides, err := NewOverrides([]string{"SERVER.PORT=8080"}, nil)
+	require.NoError(t, err)
+	require.NoError(t, k.Merge(overrides, MergeOptions{Strategy: "overwrite", KeyMatch: "insensitive"}))
+
+	require.Equal(t, map[string]string{
+		"server.port": "cli:--set",
+		"server.host": "file:///base.yaml",
+	}, origins(k))
+}
@@ -0,0 +1,200 @@
+package koanfuri
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Origin identifies the input that set a value.
+type Origin struct {
+	URI    string
+	Format string
+}
+
+// String returns the origin as "uri (format)".
+func (o Origin) String() string {
+	if o.Format == "" {
+		return o.URI
+	}
+	return fmt.Sprintf("%s (%s)", o.URI, o.Format)
+}
+
+// Explanation describes a leaf of the configuration and the input that last set it.
+type Explanation struct {
+	Path   string
+	Value  interface{}
+	Origin Origin
+}
+
+// provenanceChange is a change made to the configuration by a merge, recorded so provenance can be updated afterwards.
+type provenanceChange struct {
+	path    []string
+	removed bool
+}
+
+// provenanceTree holds the origin of every leaf of a configuration, indexed by key so that everything below a changed
+// key can be forgotten without looking at the rest of the configuration.
+type provenanceTree struct {
+	origin   Origin
+	leaf     bool
+	children map[string]*provenanceTree
+}
+
+// set records origin for the leaf at path, replacing anything recorded at or below path.
+func (t *provenanceTree) set(path []string, origin Origin) {
+	node := t
+	for _, key := range path {
+		if node.children == nil {
+			node.leaf, node.children = false, make(map[string]*provenanceTree)
+		}
+		child, ok := node.children[key]
+		if !ok {
+			child = &provenanceTree{}
+			node.children[key] = child
+		}
+		node = child
+	}
+	node.origin, node.leaf, node.children = origin, true, nil
+}
+
+// remove forgets everything recorded at or below path.
+func (t *provenanceTree) remove(path []string) {
+	if len(path) == 0 {
+		*t = provenanceTree{}
+		return
+	}
+	node := t
+	for _, key := range path[:len(path)-1] {
+		if node = node.children[key]; node == nil {
+			return
+		}
+	}
+	delete(node.children, path[len(path)-1])
+}
+
+// get returns the origin of the leaf at path and whether one is recorded.
+func (t *provenanceTree) get(path []string) (Origin, bool) {
+	node := t
+	for _, key := range path {
+		if node = node.children[key]; node == nil {
+			return Origin{}, false
+		}
+	}
+	return node.origin, node.leaf
+}
+
+// clone returns a deep copy of the tree.
+func (t *provenanceTree) clone() *provenanceTree {
+	if t == nil {
+		return nil
+	}
+	c := &provenanceTree{origin: t.origin, leaf: t.leaf}
+	if t.children != nil {
+		c.children = make(map[string]*provenanceTree, len(t.children))
+		for key, child := range t.children {
+			c.children[key] = child.clone()
+		}
+	}
+	return c
+}
+
+// initProvenance attributes every leaf of the configuration to this KoanfURI.
+func (k *KoanfURI) initProvenance() {
+	origin := Origin{URI: k.String(), Format: k.dataFormat}
+	k.provenance = &provenanceTree{}
+	walkLeaves(k.konfig.Raw(), nil, func(path []string, _ interface{}) {
+		k.provenance.set(path, origin)
+	})
+}
+
+// originOf returns the origin of the leaf at path, or the KoanfURI itself when the leaf isn't tracked.
+func (k *KoanfURI) originOf(path []string) Origin {
+	if k.provenance != nil {
+		if origin, ok := k.provenance.get(path); ok {
+			return origin
+		}
+	}
+	return Origin{URI: k.String(), Format: k.dataFormat}
+}
+
+// trackChanges updates provenance after changes made by other: removed paths are forgotten and every leaf under a
+// changed path is attributed to the input of other that set it.
+func (k *KoanfURI) trackChanges(other *KoanfURI, changes []provenanceChange) {
+	if k.provenance == nil {
+		k.provenance = &provenanceTree{}
+	}
+	raw := k.konfig.Raw()
+
+	for _, change := range changes {
+		k.provenance.remove(change.path)
+		path := change.path
+		if change.removed {
+			// A map left empty by the removal becomes a leaf set by other
+			if len(path) < 2 {
+				continue
+			}
+			path = path[:len(path)-1]
+			if parent, ok := lookupPath(raw, path); !ok || !isEmptyMap(parent) {
+				continue
+			}
+		}
+
+		value, ok := lookupPath(raw, path)
+		if !ok {
+			continue
+		}
+		walkLeaves(value, path, func(path []string, _ interface{}) {
+			k.provenance.set(path, other.originOf(path))
+		})
+	}
+}
+
+// Explain returns every leaf of the configuration with the input that last set it, sorted by path. Lists are leaves.
+func (k *KoanfURI) Explain() []Explanation {
+	var explanations []Explanation
+	walkLeaves(k.konfig.Raw(), nil, func(path []string, value interface{}) {
+		explanations = append(explanations, Explanation{
+			Path:   joinPath(path),
+			Value:  value,
+			Origin: k.originOf(path),
+		})
+	})
+
+	sort.Slice(explanations, func(i, j int) bool {
+		return explanations[i].Path < explanations[j].Path
+	})
+	return explanations
+}
+
+// walkLeaves calls fn for every leaf under value, which is found at path. Lists, scalars and empty maps are leaves.
+func walkLeaves(value interface{}, path []string, fn func(path []string, value interface{})) {
+	m, ok := value.(map[string]interface{})
+	if !ok || (len(m) == 0 && len(path) > 0) {
+		fn(path, value)
+		return
+	}
+	for key, v := range m {
+		walkLeaves(v, childPath(path, key), fn)
+	}
+}
+
+// isEmptyMap reports whether value is a map without keys.
+func isEmptyMap(value interface{}) bool {
+	m, ok := value.(map[string]interface{})
+	return ok && len(m) == 0
+}
+
+// lookupPath returns the value found at path by following maps from root.
+func lookupPath(root map[string]interface{}, path []string) (interface{}, bool) {
+	var value interface{} = root
+	for _, key := range path {
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if value, ok = m[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
@@ -0,0 +1,112 @@
+package koanfuri
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// origins returns the URI of the origin of every leaf, keyed by path.
+func origins(k *KoanfURI) map[string]string {
+	out := make(map[string]string)
+	for _, explanation := range k.Explain() {
+		out[explanation.Path] = explanation.Origin.URI
+	}
+	return out
+}
+
+func TestProvenance(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", `
+server:
+  host: localhost
+  port: 8080
+  plugins: [auth]
+database:
+  name: myapp
+  password: secret
+`)
+	patch1 := newTestKoanfURI(t, "patch1.json", `{"server": {"port": 9090, "tls": {"enabled": true}}, "database": {"password": "__TOMBSTONE__"}}`)
+	patch2 := newTestKoanfURI(t, "patch2.yaml", "server:\n  plugins: [cache]\ndatabase: postgres://db\n")
+
+	require.NoError(t, k.Merge(patch1, MergeOptions{Strategy: "preserve"}))
+	require.Equal(t, map[string]string{
+		"server.host":        "file:///base.yaml",
+		"server.port":        "file:///patch1.json",
+		"server.plugins":     "file:///base.yaml",
+		"server.tls.enabled": "file:///patch1.json",
+		"database.name":      "file:///base.yaml",
+	}, origins(k))
+
+	require.NoError(t, k.Merge(patch2, MergeOptions{Strategy: "preserve"}))
+	require.Equal(t, map[string]string{
+		"server.host":        "file:///base.yaml",
+		"server.port":        "file:///patch1.json",
+		"server.plugins":     "file:///patch2.yaml",
+		"server.tls.enabled": "file:///patch1.json",
+		"database":           "file:///patch2.yaml",
+	}, origins(k))
+
+	explanations := k.Explain()
+	require.Equal(t, "database", explanations[0].Path)
+	require.Equal(t, "postgres://db", explanations[0].Value)
+	require.Equal(t, "file:///patch2.yaml (yaml)", explanations[0].Origin.String())
+}
+
+func TestProvenanceJSONPatch(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "server:\n  host: localhost\n  port: 8080\n  plugins: [auth]\nlegacy:\n  db: postgres\n")
+	patch := newTestKoanfURI(t, "ops.json", `[
+  {"op": "replace", "path": "/server/port", "value": 9090},
+  {"op": "add", "path": "/server/plugins/-", "value": "cache"},
+  {"op": "move", "from": "/legacy/db", "path": "/database"}
+]`)
+
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, map[string]string{
+		"server.host":    "file:///base.yaml",
+		"server.port":    "file:///ops.json",
+		"server.plugins": "file:///ops.json",
+		"legacy":         "file:///ops.json",
+		"database":       "file:///ops.json",
+	}, origins(k))
+}
+
+func TestProvenanceReplacedSubtree(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "server:\n  tls:\n    cert: a.pem\n    key: a.key\n  host: localhost\n")
+	patch := newTestKoanfURI(t, "patch.yaml", "server:\n  tls: off\n")
+
+	require.NoError(t, k.Merge(patch, MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, map[string]string{
+		"server.host": "file:///base.yaml",
+		"server.tls":  "file:///patch.yaml",
+	}, origins(k))
+}
+
+// BenchmarkMergeLargeDocuments merges two documents of 20,000 keys each, so that provenance tracking costing more
+// than a walk of the changed keys shows up.
+func BenchmarkMergeLargeDocuments(b *testing.B) {
+	document := func(value int) string {
+		root := make(map[string]interface{})
+		for i := 0; i < 200; i++ {
+			group := make(map[string]interface{})
+			for j := 0; j < 100; j++ {
+				group[fmt.Sprintf("key%d", j)] = value
+			}
+			root[fmt.Sprintf("group%d", i)] = group
+		}
+		data, err := json.Marshal(root)
+		require.NoError(b, err)
+		return string(data)
+	}
+	base, patch := document(1), document(2)
+
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		k := newTestKoanfURI(b, "base.json", base)
+		p := newTestKoanfURI(b, "patch.json", patch)
+		b.StartTimer()
+
+		require.NoError(b, k.Merge(p, MergeOptions{Strategy: "overwrite"}))
+	}
+}
@@ -0,0 +1,100 @@
+package koanfuri
+
+import (
+	"fmt"
+	gopath "path"
+)
+
+// MergeRule assigns a list merge strategy to the lists found at key paths matching Path, and a null mode (see
+// MergeOptions.NullMode) to the keys found there. A rule may set either or both.
+//
+// Path is a dot separated key path where each segment may be a glob understood by path.Match, so "*" matches
+// exactly one key. A "**" segment matches any number of keys, e.g. "**.allowlist" matches an allowlist at any depth.
+type MergeRule struct {
+	Path     string `koanf:"path"`
+	Strategy string `koanf:"strategy"`
+	MergeKey string `koanf:"key"`
+	Null     string `koanf:"null"`
+}
+
+// LoadMergeRules loads merge rules from the "rules" list of the document at uri. Any URI accepted by NewKoanfURI
+// can be used, e.g.
+//
+//	rules:
+//	  - path: server.plugins
+//	    strategy: keyed
+//	    key: name
+//	  - path: "**.allowlist"
+//	    strategy: preserve
+func LoadMergeRules(uri string) ([]MergeRule, error) {
+	k, err := NewKoanfURI(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []MergeRule
+	if err := k.konfig.Unmarshal("rules", &rules); err != nil {
+		return nil, fmt.Errorf("failed to parse merge rules: %w", err)
+	}
+
+	for i, rule := range rules {
+		if rule.Path == "" {
+			return nil, fmt.Errorf("merge rule %d has no path", i)
+		}
+		if _, err := gopath.Match(rule.Path, ""); err != nil {
+			return nil, fmt.Errorf("merge rule %d has an invalid path %q: %w", i, rule.Path, err)
+		}
+	}
+
+	return rules, nil
+}
+
+// validate checks the rule's strategy and null mode, falling back to defaultKey when the rule doesn't name its own merge
+// key.
+func (r MergeRule) validate(defaultKey string) error {
+	if r.Strategy == "" && r.Null == "" {
+		return fmt.Errorf("merge rule for %q sets neither a strategy nor a null mode", r.Path)
+	}
+	if r.Strategy != "" {
+		mergeKey := r.MergeKey
+		if mergeKey == "" {
+			mergeKey = defaultKey
+		}
+		if err := validateStrategy(r.Strategy, mergeKey); err != nil {
+			return fmt.Errorf("merge rule for %q: %w", r.Path, err)
+		}
+	}
+	if err := validateNullMode(r.Null); err != nil {
+		return fmt.Errorf("merge rule for %q: %w", r.Path, err)
+	}
+	return nil
+}
+
+// matchPath reports whether the key path matches pattern. See MergeRule for the pattern syntax.
+func matchPath(pattern string, path []string) bool {
+	return matchSegments(splitPath(pattern), path)
+}
+
+func matchSegments(pattern, path []string) bool {
+	if len(pattern) == 0 {
+		return len(path) == 0
+	}
+
+	if pattern[0] == "**" {
+		// Try to let "**" swallow zero or more segments
+		for i := 0; i <= len(path); i++ {
+			if matchSegments(pattern[1:], path[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if len(path) == 0 {
+		return false
+	}
+	if ok, err := gopath.Match(pattern[0], path[0]); err != nil || !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], path[1:])
+}
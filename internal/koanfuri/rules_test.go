@@ -0,0 +1,62 @@
+package koanfuri
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		path     string
+		expected bool
+	}{
+		{pattern: "server.plugins", path: "server.plugins", expected: true},
+		{pattern: "server.plugins", path: "server.plugins.config", expected: false},
+		{pattern: "*.allowlist", path: "ingress.allowlist", expected: true},
+		{pattern: "*.allowlist", path: "api.ingress.allowlist", expected: false},
+		{pattern: "**.allowlist", path: "allowlist", expected: true},
+		{pattern: "**.allowlist", path: "api.ingress.allowlist", expected: true},
+		{pattern: "server.**", path: "server.plugins", expected: true},
+		{pattern: "server.plug*", path: "server.plugins", expected: true},
+		{pattern: "server.plugins", path: "server", expected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.pattern+"~"+tt.path, func(t *testing.T) {
+			require.Equal(t, tt.expected, matchPath(tt.pattern, splitPath(tt.path)))
+		})
+	}
+}
+
+func TestLoadMergeRules(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	rulesFile := filepath.Join(tmpDir, "rules.yaml")
+	err := os.WriteFile(rulesFile, []byte(`
+rules:
+  - path: server.plugins
+    strategy: keyed
+    key: name
+  - path: "**.allowlist"
+    strategy: preserve
+`), 0644)
+	require.NoError(t, err)
+
+	rules, err := LoadMergeRules(rulesFile)
+	require.NoError(t, err)
+	require.Equal(t, []MergeRule{
+		{Path: "server.plugins", Strategy: "keyed", MergeKey: "name"},
+		{Path: "**.allowlist", Strategy: "preserve"},
+	}, rules)
+
+	badFile := filepath.Join(tmpDir, "bad.yaml")
+	err = os.WriteFile(badFile, []byte("rules:\n  - strategy: preserve\n"), 0644)
+	require.NoError(t, err)
+
+	_, err = LoadMergeRules(badFile)
+	require.Error(t, err)
+}
@@ -0,0 +1,125 @@
+package koanfuri
+
+import (
+	"fmt"
+	"sort"
+)
+
+// transfer is a "__MOVE_FROM__" or "__COPY_FROM__" directive found in a patch: the value at from in the destination is
+// placed at to, and removed from from when move is set.
+type transfer struct {
+	from []string
+	to   []string
+	move bool
+}
+
+// applyTransfers applies every move and copy directive in the maps of src to dest. All values are read before any of
+// them is moved, so every directive sees the destination as it was before the patch, and the rest of the patch is then
+// merged on top of the transferred values.
+func (m *merger) applyTransfers(src, dest map[string]interface{}) error {
+	var transfers []transfer
+	if err := m.collectTransfers(src, nil, &transfers); err != nil {
+		return err
+	}
+	if len(transfers) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, len(transfers))
+	for i, t := range transfers {
+		value, ok := lookupPath(dest, t.from)
+		if !ok {
+			return fmt.Errorf("merge directive at %q: key %q does not exist", joinPath(t.to), joinPath(t.from))
+		}
+		values[i] = deepCopy(value)
+	}
+
+	for _, t := range transfers {
+		if !t.move {
+			continue
+		}
+		if parent, ok := lookupPath(dest, t.from[:len(t.from)-1]); ok {
+			delete(parent.(map[string]interface{}), t.from[len(t.from)-1])
+		}
+		m.record(t.from, true)
+	}
+
+	// Shorter paths first, so that a transfer into a transferred map isn't overwritten by it
+	order := make([]int, len(transfers))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return len(transfers[order[i]].to) < len(transfers[order[j]].to)
+	})
+	for _, i := range order {
+		setPath(dest, transfers[i].to, values[i])
+		m.record(transfers[i].to, false)
+	}
+	return nil
+}
+
+// collectTransfers appends the move and copy directives found in src, which is at path, and in the maps below it.
+func (m *merger) collectTransfers(src map[string]interface{}, path []string, transfers *[]transfer) error {
+	for k, v := range src {
+		srcMap, ok := v.(map[string]interface{})
+		if !ok || isDirectiveKey(k) || isWrapper(srcMap) {
+			continue
+		}
+		keyPath := childPath(path, k)
+
+		moveFrom, err := readDirective(srcMap, directiveMoveFrom, keyPath)
+		if err != nil {
+			return err
+		}
+		copyFrom, err := readDirective(srcMap, directiveCopyFrom, keyPath)
+		if err != nil {
+			return err
+		}
+		switch {
+		case moveFrom != "" && copyFrom != "":
+			return fmt.Errorf("merge directives %s and %s at %q cannot be combined", directiveMoveFrom, directiveCopyFrom, joinPath(keyPath))
+		case moveFrom != "":
+			*transfers = append(*transfers, transfer{from: splitPath(moveFrom), to: keyPath, move: true})
+		case copyFrom != "":
+			*transfers = append(*transfers, transfer{from: splitPath(copyFrom), to: keyPath})
+		}
+
+		if err := m.collectTransfers(srcMap, keyPath, transfers); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isTransferOnly reports whether v is a map holding a move or copy directive and nothing to merge on top of it.
+func isTransferOnly(v interface{}) bool {
+	srcMap, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, hasMove := srcMap[directiveMoveFrom]
+	_, hasCopy := srcMap[directiveCopyFrom]
+	if !hasMove && !hasCopy {
+		return false
+	}
+	for k := range srcMap {
+		if !isDirectiveKey(k) {
+			return false
+		}
+	}
+	return true
+}
+
+// setPath stores value at path in root, creating the maps leading to it and replacing anything in the way that isn't one.
+func setPath(root map[string]interface{}, path []string, value interface{}) {
+	for _, key := range path[:len(path)-1] {
+		next, ok := root[key].(map[string]interface{})
+		if !ok {
+			next = make(map[string]interface{})
+			root[key] = next
+		}
+		root = next
+	}
+	root[path[len(path)-1]] = value
+}
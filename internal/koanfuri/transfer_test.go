@@ -0,0 +1,106 @@
+package koanfuri
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeTransfers(t *testing.T) {
+	const base = `
+database:
+  host: localhost
+  port: 5432
+legacy:
+  timeout: 30
+  retries: 3
+server:
+  name: api
+`
+	tests := []struct {
+		name     string
+		patch    string
+		expected map[string]interface{}
+		err      string
+	}{
+		{
+			name:  "move renames a key",
+			patch: "datastore:\n  __MOVE_FROM__: database\n",
+			expected: map[string]interface{}{
+				"datastore": map[string]interface{}{"host": "localhost", "port": 5432},
+				"legacy":    map[string]interface{}{"timeout": 30, "retries": 3},
+				"server":    map[string]interface{}{"name": "api"},
+			},
+		},
+		{
+			name:  "move merges the rest of the map on top",
+			patch: "datastore:\n  __MOVE_FROM__: database\n  host: db.internal\n  port: __TOMBSTONE__\n",
+			expected: map[string]interface{}{
+				"datastore": map[string]interface{}{"host": "db.internal"},
+				"legacy":    map[string]interface{}{"timeout": 30, "retries": 3},
+				"server":    map[string]interface{}{"name": "api"},
+			},
+		},
+		{
+			name:  "copy keeps the original and moves scalars between paths",
+			patch: "server:\n  timeout:\n    __MOVE_FROM__: legacy.timeout\n  backup:\n    __COPY_FROM__: database\n",
+			expected: map[string]interface{}{
+				"database": map[string]interface{}{"host": "localhost", "port": 5432},
+				"legacy":   map[string]interface{}{"retries": 3},
+				"server": map[string]interface{}{
+					"name":    "api",
+					"timeout": 30,
+					"backup":  map[string]interface{}{"host": "localhost", "port": 5432},
+				},
+			},
+		},
+		{
+			name:  "values are read before the patch changes them",
+			patch: "database:\n  host: db.internal\ndatastore:\n  __COPY_FROM__: database\n",
+			expected: map[string]interface{}{
+				"database":  map[string]interface{}{"host": "db.internal", "port": 5432},
+				"datastore": map[string]interface{}{"host": "localhost", "port": 5432},
+				"legacy":    map[string]interface{}{"timeout": 30, "retries": 3},
+				"server":    map[string]interface{}{"name": "api"},
+			},
+		},
+		{
+			name:  "swap two keys",
+			patch: "database:\n  __MOVE_FROM__: legacy\nlegacy:\n  __MOVE_FROM__: database\n",
+			expected: map[string]interface{}{
+				"database": map[string]interface{}{"timeout": 30, "retries": 3},
+				"legacy":   map[string]interface{}{"host": "localhost", "port": 5432},
+				"server":   map[string]interface{}{"name": "api"},
+			},
+		},
+		{
+			name:  "missing source",
+			patch: "datastore:\n  __MOVE_FROM__: db\n",
+			err:   `merge directive at "datastore": key "db" does not exist`,
+		},
+		{
+			name:  "move and copy together",
+			patch: "datastore:\n  __MOVE_FROM__: database\n  __COPY_FROM__: database\n",
+			err:   "cannot be combined",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			k := newTestKoanfURI(t, "base.yaml", base)
+			err := k.Merge(newTestKoanfURI(t, "patch.yaml", tc.patch), MergeOptions{Strategy: "overwrite", OnTypeConflict: "error"})
+			if tc.err != "" {
+				require.ErrorContains(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.expected, k.konfig.Raw())
+		})
+	}
+}
+
+func TestMergeTransferProvenance(t *testing.T) {
+	k := newTestKoanfURI(t, "base.yaml", "database:\n  host: localhost\n")
+	require.NoError(t, k.Merge(newTestKoanfURI(t, "patch.yaml", "datastore:\n  __MOVE_FROM__: database\n"), MergeOptions{Strategy: "overwrite"}))
+	require.Equal(t, map[string]string{"datastore.host": "file:///patch.yaml"}, origins(k))
+}
@@ -0,0 +1,46 @@
+package conditions
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mad-weaver/laminate/tests/func/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConditionalPatches(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	cmd := exec.Command("go", "run", mainPath,
+		"--source", filepath.Join("testdata", "base.yaml"),
+		"--patch", filepath.Join("testdata", "eu-prod.yaml"),
+		"--patch", filepath.Join("testdata", "dev.yaml"),
+		"--var", "stage=ci",
+		"--output-format", "json")
+
+	output, err := cmd.Output()
+	require.NoError(t, err, "laminate command failed: %s", string(output))
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+	require.Equal(t, map[string]interface{}{
+		"env":      "prod",
+		"region":   "eu-west-1",
+		"replicas": float64(3),
+	}, result)
+}
+
+func TestConditionalSource(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	cmd := exec.Command("go", "run", mainPath,
+		"--source", filepath.Join("testdata", "conditional-source.yaml"))
+
+	output, err := cmd.CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), "__ASSERT__ and __WHEN__ cannot be used in source")
+}
@@ -0,0 +1,66 @@
+package explain
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mad-weaver/laminate/tests/func/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExplain(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	// Get paths to test data files
+	testDataDir := filepath.Join("testdata")
+	baseFile := filepath.Join(testDataDir, "base.yaml")
+	patchFile := filepath.Join(testDataDir, "patch.yaml")
+
+	testCases := []struct {
+		name     string
+		args     []string
+		expected []string
+	}{
+		{
+			name: "all_keys",
+			args: nil,
+			expected: []string{
+				`database.name = "myapp"  # file://`,
+				`database.user = "admin"  # file://`,
+				`server.host = "localhost"  # file://`,
+				`server.port = 9090  # file://`,
+			},
+		},
+		{
+			name: "selected_keys",
+			args: []string{"server.port"},
+			expected: []string{
+				`server.port = 9090  # file://`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			args := append([]string{"run", mainPath, "--source", baseFile, "--patch", patchFile, "explain"}, tc.args...)
+			output, err := exec.Command("go", args...).CombinedOutput()
+			require.NoError(t, err, "laminate command failed: %s", string(output))
+
+			lines := strings.Split(strings.TrimSpace(string(output)), "\n")
+			require.Len(t, lines, len(tc.expected))
+			for i, line := range lines {
+				require.True(t, strings.HasPrefix(line, tc.expected[i]), "unexpected line %q", line)
+			}
+			require.Contains(t, string(output), "patch.yaml (yaml)")
+		})
+	}
+
+	t.Run("unknown_key", func(t *testing.T) {
+		output, err := exec.Command("go", "run", mainPath, "--source", baseFile, "--patch", patchFile, "explain", "missing.key").CombinedOutput()
+		require.Error(t, err)
+		require.Contains(t, string(output), "not found in merged configuration")
+	})
+}
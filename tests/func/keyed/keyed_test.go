@@ -0,0 +1,80 @@
+package keyed
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mad-weaver/laminate/tests/func/testutil"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestKeyedMergeStrategy(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	// Get paths to test data files
+	testDataDir := filepath.Join("testdata")
+	baseFile := filepath.Join(testDataDir, "base_list.yaml")
+	patchFile := filepath.Join(testDataDir, "patch_list.yaml")
+
+	// Test with different output formats
+	testCases := []struct {
+		name         string
+		outputFormat string
+		decoder      func([]byte, interface{}) error
+	}{
+		{
+			name:         "yaml_output_format",
+			outputFormat: "yaml",
+			decoder:      yaml.Unmarshal,
+		},
+		{
+			name:         "json_output_format",
+			outputFormat: "json",
+			decoder:      json.Unmarshal,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			// Run laminate with keyed merge strategy
+			cmd := exec.Command("go", "run", mainPath,
+				"--source", baseFile,
+				"--patch", patchFile,
+				"--merge-strategy", "keyed",
+				"--merge-key", "name",
+				"--output-format", tc.outputFormat)
+
+			output, err := cmd.CombinedOutput()
+			require.NoError(t, err, "laminate command failed: %s", string(output))
+
+			// Parse the output
+			var result map[string]interface{}
+			err = tc.decoder(output, &result)
+			require.NoError(t, err, "failed to decode output")
+
+			// Get the plugins list
+			plugins, ok := result["server"].(map[string]interface{})["plugins"].([]interface{})
+			require.True(t, ok, "failed to get plugins list")
+
+			// Verify auth was merged in place (3 original + 1 new = 4 total)
+			require.Len(t, plugins, 4, "plugins list should have 4 items")
+
+			// Check auth plugin keeps its position and gains the patched field
+			auth := plugins[0].(map[string]interface{})
+			require.Equal(t, "auth", auth["name"])
+			require.Equal(t, true, auth["enabled"])
+			authConfig := auth["config"].(map[string]interface{})
+			require.EqualValues(t, 30, authConfig["timeout"])
+			require.EqualValues(t, 3, authConfig["retries"])
+
+			// Check new cache plugin (should be appended)
+			cache := plugins[3].(map[string]interface{})
+			require.Equal(t, "cache", cache["name"])
+			require.Equal(t, true, cache["enabled"])
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package merge3
+
+import (
+	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mad-weaver/laminate/tests/func/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMerge3(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	// Get paths to test data files
+	testDataDir := filepath.Join("testdata")
+	baseFile := filepath.Join(testDataDir, "base.yaml")
+	oursFile := filepath.Join(testDataDir, "ours.yaml")
+
+	t.Run("clean_merge", func(t *testing.T) {
+		cmd := exec.Command("go", "run", mainPath, "--output-format", "json",
+			"merge3", "--base", baseFile, "--ours", oursFile, "--theirs", filepath.Join(testDataDir, "theirs.json"))
+
+		output, err := cmd.Output()
+		require.NoError(t, err, "laminate command failed: %s", string(output))
+
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+		require.Equal(t, map[string]interface{}{
+			"server":   map[string]interface{}{"host": "example.com", "port": float64(9090)},
+			"database": map[string]interface{}{"name": "myapp", "user": "admin"},
+		}, result)
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		conflictsFile := filepath.Join(t.TempDir(), "conflicts.json")
+		cmd := exec.Command("go", "run", mainPath, "--output-format", "json",
+			"merge3", "--base", baseFile, "--ours", oursFile, "--theirs", filepath.Join(testDataDir, "theirs_conflict.yaml"),
+			"--conflicts", conflictsFile)
+
+		output, err := cmd.Output()
+		require.Error(t, err, "laminate should fail on conflicts")
+
+		// Conflicting keys keep our value
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+		require.Equal(t, float64(9090), result["server"].(map[string]interface{})["port"])
+
+		data, err := os.ReadFile(conflictsFile)
+		require.NoError(t, err)
+		var conflicts []map[string]interface{}
+		require.NoError(t, json.Unmarshal(data, &conflicts), "failed to decode conflicts")
+		require.Equal(t, []map[string]interface{}{
+			{"path": "server.port", "base": float64(8080), "ours": float64(9090), "theirs": float64(7070)},
+		}, conflicts)
+	})
+	t.Run("locked_keys", func(t *testing.T) {
+		cmd := exec.Command("go", "run", mainPath, "--output-format", "json",
+			"merge3", "--base", filepath.Join(testDataDir, "locked_base.yaml"),
+			"--ours", filepath.Join(testDataDir, "locked_ours.yaml"),
+			"--theirs", filepath.Join(testDataDir, "locked_theirs.yaml"))
+
+		output, err := cmd.Output()
+		require.NoError(t, err, "laminate command failed: %s", string(output))
+
+		// The lock list changed by theirs is kept in the output
+		var result map[string]interface{}
+		require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+		require.Equal(t, map[string]interface{}{
+			"__LOCKED__": []interface{}{"server.port", "server.host"},
+			"server":     map[string]interface{}{"host": "example.com", "port": float64(8080)},
+		}, result)
+	})
+}
@@ -0,0 +1,60 @@
+package options
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mad-weaver/laminate/tests/func/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInputOptions(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	// Get paths to test data files
+	baseFile := filepath.Join("testdata", "base.yaml")
+	apiFile := filepath.Join("testdata", "api.yaml")
+	pluginsFile := filepath.Join("testdata", "plugins.yaml")
+	missingFile := filepath.Join("testdata", "missing.yaml")
+
+	cmd := exec.Command("go", "run", mainPath,
+		"--source", baseFile,
+		"--patch", apiFile+";mount=services.api;strategy=preserve",
+		"--patch", pluginsFile,
+		"--patch", missingFile+";optional",
+		"--patch", "-;format=json;strategy=union",
+		"--output-format", "json")
+	cmd.Stdin = strings.NewReader(`{"plugins": ["cache", "metrics"]}`)
+
+	output, err := cmd.Output()
+	require.NoError(t, err, "laminate command failed: %s", string(output))
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+	require.Equal(t, map[string]interface{}{
+		"services": map[string]interface{}{
+			"api": map[string]interface{}{
+				"port": float64(8080),
+				"tags": []interface{}{"public", "internal"},
+			},
+		},
+		"plugins": []interface{}{"cache", "metrics"},
+	}, result)
+}
+
+func TestMissingInput(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	cmd := exec.Command("go", "run", mainPath,
+		"--source", filepath.Join("testdata", "base.yaml"),
+		"--patch", filepath.Join("testdata", "missing.yaml"))
+
+	output, err := cmd.CombinedOutput()
+	require.Error(t, err)
+	require.Contains(t, string(output), "no such file or directory")
+}
@@ -0,0 +1,68 @@
+package set
+
+import (
+	"encoding/json"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/mad-weaver/laminate/tests/func/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetAndUnset(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	// Get paths to test data files
+	baseFile := filepath.Join("testdata", "base.yaml")
+
+	cmd := exec.Command("go", "run", mainPath,
+		"--source", baseFile,
+		"--set", "servers[name=web].port=8443",
+		"--set", "plugins[1].enabled=false",
+		"--set", "tags=[blue, green]",
+		"--unset", "servers[name=api]",
+		"--output-format", "json")
+
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "laminate command failed: %s", string(output))
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+	require.Equal(t, map[string]interface{}{
+		"servers": []interface{}{
+			map[string]interface{}{"name": "web", "port": float64(8443)},
+		},
+		"plugins": []interface{}{
+			map[string]interface{}{"name": "auth", "enabled": true},
+			map[string]interface{}{"name": "cache", "enabled": false},
+		},
+		"tags": []interface{}{"blue", "green"},
+	}, result)
+}
+
+func TestSetWithPatchList(t *testing.T) {
+	// Get the path to main.go
+	mainPath := testutil.GetMainPath(t)
+
+	// --patch still splits on commas, while --set values keep them
+	cmd := exec.Command("go", "run", mainPath,
+		"--source", filepath.Join("testdata", "base.yaml"),
+		"--patch", filepath.Join("testdata", "region.yaml")+","+filepath.Join("testdata", "owner.yaml"),
+		"--set", "tags=[blue, green]",
+		"--unset", "servers",
+		"--unset", "plugins",
+		"--output-format", "json")
+
+	output, err := cmd.CombinedOutput()
+	require.NoError(t, err, "laminate command failed: %s", string(output))
+
+	var result map[string]interface{}
+	require.NoError(t, json.Unmarshal(output, &result), "failed to decode output")
+	require.Equal(t, map[string]interface{}{
+		"region": "eu",
+		"owner":  "ops",
+		"tags":   []interface{}{"blue", "green"},
+	}, result)
+}